@@ -1,25 +1,52 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
 
 	"orus.io/orus-io/beaver/runner"
 )
 
+// watchDebounce is the delay without any change after which a watch build
+// starts.
+const watchDebounce = 300 * time.Millisecond
+
 type BuildCmd struct {
 	Args struct {
-		DryRun         bool   `short:"d" long:"dry-run" description:"if set only prints commands but do not run them"`
-		Keep           bool   `short:"k" long:"keep" description:"Keep the temporary files"`
-		Output         string `short:"o" long:"output" description:"output directory, use \"stdout\" to print to stdout"`
-		Namespace      string `short:"n" long:"namespace" description:"force helm namespace flag for all helm charts"`
-		WithoutHydrate bool   `short:"h" long:"without-hydrate" description:"don't hydrate files with beaver variables"`
+		DryRun         bool     `short:"d" long:"dry-run" description:"if set only prints commands but do not run them"`
+		Keep           bool     `short:"k" long:"keep" description:"Keep the temporary files"`
+		Output         string   `short:"o" long:"output" description:"output directory, use \"stdout\" to print to stdout"`
+		Namespace      string   `short:"n" long:"namespace" description:"force helm namespace flag for all helm charts"`
+		WithoutHydrate bool     `short:"h" long:"without-hydrate" description:"don't hydrate files with beaver variables"`
+		Watch          bool     `short:"w" long:"watch" description:"rebuild each time a file of the project changes"`
+		Jobs           int      `short:"j" long:"jobs" description:"number of projects built concurrently (default: CPUs)"`
+		MaxDepth       int      `long:"max-depth" description:"maximum depth of nested variable references" default:"16"`
+		Set            []string `long:"set" description:"set a variable after every layer, eg. image.tag=1.2.3 (yaml value)"`
+		SetFile        []string `long:"set-file" description:"set a variable to the content of a file after every layer"`
 	}
 	PositionalArgs struct {
-		DirName string `required:"yes" positional-arg-name:"directory"`
+		DirNames []string `required:"1" positional-arg-name:"directory"`
 	} `positional-args:"yes"`
 }
 
+// buildResult is the outcome of the build of a single project.
+type buildResult struct {
+	dir  string
+	diff *runner.BuildDiff
+	err  error
+}
+
 // NewBuildCmd ...
 func NewBuildCmd() *BuildCmd {
 	cmd := BuildCmd{}
@@ -30,17 +57,160 @@ func NewBuildCmd() *BuildCmd {
 // Execute ...
 func (cmd *BuildCmd) Execute([]string) error {
 	log := LoggingOptions.Logger()
-	log.Debug().Str("directory", cmd.PositionalArgs.DirName).Msg("starting beaver")
+	log.Debug().Strs("directories", cmd.PositionalArgs.DirNames).Msg("starting beaver")
+
+	dirs, err := expandDirs(cmd.PositionalArgs.DirNames)
+	if err != nil {
+		return err
+	}
+
+	if len(dirs) > 1 && cmd.Args.Output != "" {
+		return fmt.Errorf("--output cannot be used when building several projects")
+	}
+
+	if !cmd.Args.Watch {
+		return cmd.buildAll(log, dirs)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rebuild := func() {
+		if err := cmd.buildAll(log, dirs); err != nil {
+			log.Err(err).Msg("build failed")
+		}
+	}
+
+	rebuild()
+
+	return runner.Watch(ctx, log, watchDebounce, cmd.watchedPaths(log, dirs), rebuild)
+}
+
+// buildAll builds the projects found in dirs with a pool of workers, the
+// parsed layers and the helm dependency builds are shared between them. When
+// several projects are built, a report is printed once they are all done.
+func (cmd *BuildCmd) buildAll(log zerolog.Logger, dirs []string) error {
+	jobs := cmd.Args.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	if cmd.Args.DryRun || cmd.Args.Output == "stdout" {
+		// keep the printed commands or resources of each project together
+		jobs = 1
+	}
+
+	cache := runner.NewCache()
+
+	if err := cmd.checkOutputDirs(log, dirs, cache); err != nil {
+		return err
+	}
+	results := make([]buildResult, len(dirs))
+	// the changes are only printed in watch mode or with several projects
+	diff := cmd.Args.Watch || len(dirs) > 1
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(jobs, len(dirs)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				changes, err := cmd.build(log.With().Str("directory", dirs[i]).Logger(), dirs[i], cache, diff)
+				results[i] = buildResult{dir: dirs[i], diff: changes, err: err}
+			}
+		}()
+	}
+
+	for i := range dirs {
+		indexes <- i
+	}
 
+	close(indexes)
+	wg.Wait()
+
+	if len(results) == 1 {
+		if results[0].err == nil && cmd.Args.Watch {
+			printBuildDiff("build done", results[0].diff)
+		}
+
+		return results[0].err
+	}
+
+	failed := 0
+
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+
+			fmt.Printf("FAILED %s: %s\n", result.dir, result.err)
+
+			continue
+		}
+
+		printBuildDiff("ok     "+result.dir, result.diff)
+	}
+
+	fmt.Printf("%d projects built, %d failed\n", len(results)-failed, failed)
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d builds failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// printBuildDiff prints a line starting with prefix which summarizes the
+// changes made by a build, followed by the changed resources.
+func printBuildDiff(prefix string, diff *runner.BuildDiff) {
+	switch {
+	case diff == nil:
+		fmt.Println(prefix)
+	case !diff.HasChanges():
+		fmt.Printf("%s, no resource changed\n", prefix)
+	default:
+		fmt.Printf("%s, %s\n", prefix, diff.Summary())
+
+		for _, name := range diff.Added {
+			fmt.Printf("  added: %s\n", name)
+		}
+
+		for _, name := range diff.Removed {
+			fmt.Printf("  removed: %s\n", name)
+		}
+
+		for _, name := range diff.Modified {
+			fmt.Printf("  modified: %s\n", name)
+		}
+	}
+}
+
+// build runs a single build and, when diff is set, returns the changes it made
+// in the output directory, or nil when printing to stdout.
+func (cmd *BuildCmd) build(
+	log zerolog.Logger, dir string, cache *runner.Cache, diff bool,
+) (*runner.BuildDiff, error) {
 	config := runner.NewCmdConfig(
 		log,
 		".",
-		cmd.PositionalArgs.DirName,
+		dir,
 		cmd.Args.DryRun,
 		cmd.Args.WithoutHydrate,
 		cmd.Args.Output,
 		cmd.Args.Namespace,
 	)
+	config.Cache = cache
+	config.HydrateMaxDepth = cmd.Args.MaxDepth
+
+	overrides, err := overrideVariables(cmd.Args.Set, cmd.Args.SetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Overrides = overrides
 
 	path, err := os.Getwd()
 	if err != nil {
@@ -49,7 +219,7 @@ func (cmd *BuildCmd) Execute([]string) error {
 
 	tmpDir, err := os.MkdirTemp(path, ".beaver-")
 	if err != nil {
-		return fmt.Errorf("failed to create temp dir: %w", err)
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
 
 	if !cmd.Args.Keep {
@@ -61,12 +231,164 @@ func (cmd *BuildCmd) Execute([]string) error {
 	}
 
 	if err := config.Initialize(tmpDir); err != nil {
-		return fmt.Errorf("failed to prepare config: %w", err)
+		return nil, fmt.Errorf("failed to prepare config: %w", err)
 	}
 
 	r := runner.NewRunner(config)
 
-	return r.Build(tmpDir)
+	outputDir, err := r.OutputDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if !diff || outputDir == "stdout" || cmd.Args.DryRun {
+		return nil, r.BuildTo(tmpDir, outputDir)
+	}
+
+	before, err := runner.ReadResources(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.BuildTo(tmpDir, outputDir); err != nil {
+		return nil, err
+	}
+
+	after, err := runner.ReadResources(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.DiffResources(before, after)
+}
+
+// loadConfig loads the config of a project, without building it.
+func (cmd *BuildCmd) loadConfig(log zerolog.Logger, dir string, cache *runner.Cache) (*runner.CmdConfig, error) {
+	config := runner.NewCmdConfig(log, ".", dir, true, false, cmd.Args.Output, cmd.Args.Namespace)
+	config.Cache = cache
+	config.HydrateMaxDepth = cmd.Args.MaxDepth
+
+	overrides, err := overrideVariables(cmd.Args.Set, cmd.Args.SetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Overrides = overrides
+
+	if err := config.Load(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// checkOutputDirs fails when several projects are built into the same output
+// directory, as their builds would clean and write it concurrently.
+func (cmd *BuildCmd) checkOutputDirs(log zerolog.Logger, dirs []string, cache *runner.Cache) error {
+	if len(dirs) < 2 || cmd.Args.DryRun {
+		return nil
+	}
+
+	projects := make(map[string]string, len(dirs))
+
+	for _, dir := range dirs {
+		config, err := cmd.loadConfig(log, dir, cache)
+		if err != nil {
+			return err
+		}
+
+		outputDir, err := runner.NewRunner(config).OutputDir()
+		if err != nil {
+			return err
+		}
+
+		if outputDir, err = filepath.Abs(outputDir); err != nil {
+			return fmt.Errorf("failed to find abs() for %s: %w", outputDir, err)
+		}
+
+		if other, ok := projects[outputDir]; ok {
+			return fmt.Errorf("%s and %s are both built into %s", other, dir, outputDir)
+		}
+
+		projects[outputDir] = dir
+	}
+
+	return nil
+}
+
+// watchedPaths returns a function listing the paths the builds depend on, and
+// the paths they write.
+func (cmd *BuildCmd) watchedPaths(log zerolog.Logger, dirs []string) func() ([]string, []string, error) {
+	return func() ([]string, []string, error) {
+		var paths, ignored []string
+
+		cache := runner.NewCache()
+
+		for _, dir := range dirs {
+			config, err := cmd.loadConfig(log, dir, cache)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			paths = append(paths, config.WatchedPaths()...)
+
+			written, err := runner.NewRunner(config).IgnoredPaths()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			ignored = append(ignored, written...)
+		}
+
+		for _, set := range cmd.Args.SetFile {
+			if _, file, ok := strings.Cut(set, "="); ok && !slices.Contains(paths, file) {
+				paths = append(paths, file)
+			}
+		}
+
+		return paths, ignored, nil
+	}
+}
+
+// expandDirs expands the glob patterns found in the given directories, a
+// pattern must match at least one directory.
+func expandDirs(patterns []string) ([]string, error) {
+	var dirs []string
+
+	add := func(dir string) {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		found := false
+
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				add(match)
+
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("no directory matches %q", pattern)
+		}
+	}
+
+	return dirs, nil
 }
 
 func init() {
@@ -84,3 +406,42 @@ func init() {
 
 	g.Namespace = "log"
 }
+
+// overrideVariables parses the --set and --set-file flags, in this order. Each
+// flag is a `name=value` pair, where name can be a dotted path and value is
+// respectively a yaml value or a file name.
+func overrideVariables(set, setFile []string) (runner.Variables, error) {
+	var variables runner.Variables
+
+	for _, flag := range set {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --set %q, expects name=value", flag)
+		}
+
+		var parsed interface{} = ""
+		if value != "" {
+			if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+				return nil, fmt.Errorf("invalid --set %q: %w", flag, err)
+			}
+		}
+
+		variables = append(variables, runner.Variable{Name: name, Value: parsed})
+	}
+
+	for _, flag := range setFile {
+		name, file, ok := strings.Cut(flag, "=")
+		if !ok || name == "" || file == "" {
+			return nil, fmt.Errorf("invalid --set-file %q, expects name=file", flag)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --set-file %q: %w", flag, err)
+		}
+
+		variables = append(variables, runner.Variable{Name: name, Value: string(content)})
+	}
+
+	return variables, nil
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// DiffCmd is the "diff" command.
+type DiffCmd struct {
+	Args struct {
+		Keep           bool     `short:"k" long:"keep" description:"Keep the temporary files"`
+		Output         string   `short:"o" long:"output" description:"output directory to compare with, defaults to the build output directory"`
+		Namespace      string   `short:"n" long:"namespace" description:"force helm namespace flag for all helm charts"`
+		WithoutHydrate bool     `short:"h" long:"without-hydrate" description:"don't hydrate files with beaver variables"`
+		MaxDepth       int      `long:"max-depth" description:"maximum depth of nested variable references" default:"16"`
+		Set            []string `long:"set" description:"set a variable after every layer, eg. image.tag=1.2.3 (yaml value)"`
+		SetFile        []string `long:"set-file" description:"set a variable to the content of a file after every layer"`
+	}
+	PositionalArgs struct {
+		DirName string `required:"yes" positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+// NewDiffCmd ...
+func NewDiffCmd() *DiffCmd {
+	cmd := DiffCmd{}
+
+	return &cmd
+}
+
+// Execute builds the project in a temporary directory and compares it with
+// the existing output directory.
+func (cmd *DiffCmd) Execute([]string) error {
+	log := LoggingOptions.Logger()
+	log.Debug().Str("directory", cmd.PositionalArgs.DirName).Msg("starting beaver diff")
+
+	if cmd.Args.Output == "stdout" {
+		return errors.New("cannot diff against stdout")
+	}
+
+	config := runner.NewCmdConfig(
+		log,
+		".",
+		cmd.PositionalArgs.DirName,
+		false,
+		cmd.Args.WithoutHydrate,
+		cmd.Args.Output,
+		cmd.Args.Namespace,
+	)
+	config.HydrateMaxDepth = cmd.Args.MaxDepth
+
+	overrides, err := overrideVariables(cmd.Args.Set, cmd.Args.SetFile)
+	if err != nil {
+		return err
+	}
+
+	config.Overrides = overrides
+
+	path, err := os.Getwd()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot get current working directory")
+	}
+
+	tmpDir, err := os.MkdirTemp(path, ".beaver-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	if !cmd.Args.Keep {
+		defer func() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				log.Err(err).Str("tempdir", tmpDir).Msg("failed to remove temp dir")
+			}
+		}()
+	}
+
+	if err := config.Initialize(tmpDir); err != nil {
+		return fmt.Errorf("failed to prepare config: %w", err)
+	}
+
+	r := runner.NewRunner(config)
+
+	currentDir, err := r.OutputDir()
+	if err != nil {
+		return err
+	}
+
+	newDir := filepath.Join(tmpDir, "build")
+	if err := r.BuildTo(tmpDir, newDir); err != nil {
+		return err
+	}
+
+	diff, err := runner.DiffDirs(currentDir, newDir)
+	if err != nil {
+		return err
+	}
+
+	if !diff.HasChanges() {
+		fmt.Printf("%s is up to date\n", currentDir)
+
+		return nil
+	}
+
+	fmt.Print(diff.String())
+
+	return fmt.Errorf("%s is not up to date: %s", currentDir, diff.Summary())
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"diff",
+		"Compare a fresh build with the output directory",
+		"Build the project in a temporary directory and print a per resource diff against the output directory."+
+			" Exits with a non-zero status if they differ.",
+		NewDiffCmd(),
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// GraphCmd is the "graph" command.
+type GraphCmd struct {
+	Args struct {
+		Format  string `short:"f" long:"format" description:"output format" choice:"dot" choice:"mermaid" default:"dot"`
+		Reverse bool   `short:"r" long:"reverse" description:"show the projects which inherit the given directories"`
+		Root    string `long:"root" description:"where to look for projects in reverse mode" default:"."`
+	}
+	PositionalArgs struct {
+		DirNames []string `required:"1" positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+// NewGraphCmd ...
+func NewGraphCmd() *GraphCmd {
+	cmd := GraphCmd{}
+
+	return &cmd
+}
+
+// Execute prints the inheritance graph of beaver projects.
+func (cmd *GraphCmd) Execute([]string) error {
+	log := LoggingOptions.Logger()
+	log.Debug().Strs("directories", cmd.PositionalArgs.DirNames).Msg("starting beaver graph")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("cannot get current working directory: %w", err)
+	}
+
+	dirs := make([]string, 0, len(cmd.PositionalArgs.DirNames))
+
+	for _, dir := range cmd.PositionalArgs.DirNames {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to find abs() for %s: %w", dir, err)
+		}
+
+		dirs = append(dirs, absDir)
+	}
+
+	var graph *runner.InheritanceGraph
+
+	if cmd.Args.Reverse {
+		projects, err := runner.FindProjects(cmd.Args.Root)
+		if err != nil {
+			return err
+		}
+
+		// a broken project must not prevent from graphing the others
+		var valid []string
+
+		for _, project := range projects {
+			absProject, err := filepath.Abs(project)
+			if err != nil {
+				return fmt.Errorf("failed to find abs() for %s: %w", project, err)
+			}
+
+			if _, err := runner.NewInheritanceGraph([]string{absProject}); err != nil {
+				log.Warn().Err(err).Str("directory", project).Msg("skipping project")
+
+				continue
+			}
+
+			valid = append(valid, absProject)
+		}
+
+		all, err := runner.NewInheritanceGraph(valid)
+		if err != nil {
+			return err
+		}
+
+		if graph, err = all.Dependents(dirs); err != nil {
+			return err
+		}
+	} else if graph, err = runner.NewInheritanceGraph(dirs); err != nil {
+		return err
+	}
+
+	if cmd.Args.Format == "mermaid" {
+		fmt.Print(graph.Mermaid(cwd))
+	} else {
+		fmt.Print(graph.DOT(cwd))
+	}
+
+	return nil
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"graph",
+		"Print the inheritance graph of projects",
+		"Print the inheritance graph of projects as DOT or Mermaid, "+
+			"with the charts each layer declares or disables and the variables it overrides.",
+		NewGraphCmd(),
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// InspectCmd is the "inspect" command.
+type InspectCmd struct {
+	Args struct {
+		Format    string `short:"f" long:"format" description:"output format" choice:"yaml" choice:"json" default:"yaml"`
+		Namespace string `short:"n" long:"namespace" description:"force helm namespace flag for all helm charts"`
+	}
+	PositionalArgs struct {
+		DirName string `required:"yes" positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+// NewInspectCmd ...
+func NewInspectCmd() *InspectCmd {
+	cmd := InspectCmd{}
+
+	return &cmd
+}
+
+// Execute prints the resolved configuration of a beaver project.
+func (cmd *InspectCmd) Execute([]string) error {
+	log := LoggingOptions.Logger()
+	log.Debug().Str("directory", cmd.PositionalArgs.DirName).Msg("starting beaver inspect")
+
+	config := runner.NewCmdConfig(
+		log,
+		".",
+		cmd.PositionalArgs.DirName,
+		true,
+		false,
+		"",
+		cmd.Args.Namespace,
+	)
+
+	if err := config.Load(); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	inspection := config.Inspect()
+
+	if cmd.Args.Format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(inspection); err != nil {
+			return fmt.Errorf("cannot encode config: %w", err)
+		}
+
+		return nil
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(inspection); err != nil {
+		return fmt.Errorf("cannot encode config: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"inspect",
+		"Print the resolved project configuration",
+		"Print the project configuration once all inherited layers are merged, without running any command.",
+		NewInspectCmd(),
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
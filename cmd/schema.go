@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// SchemaCmd is the "schema" command.
+type SchemaCmd struct{}
+
+// Execute prints the JSON schema of the beaver config files.
+func (cmd *SchemaCmd) Execute([]string) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(runner.JSONSchema()); err != nil {
+		return fmt.Errorf("cannot encode schema: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"schema",
+		"Print the JSON schema of the config files",
+		"Print the JSON schema of the beaver config files, for editors to complete and validate them.",
+		&SchemaCmd{},
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// ValidateCmd is the "validate" command.
+type ValidateCmd struct {
+	Args struct {
+		Set     []string `long:"set" description:"set a variable after every layer, eg. image.tag=1.2.3 (yaml value)"`
+		SetFile []string `long:"set-file" description:"set a variable to the content of a file after every layer"`
+	}
+	PositionalArgs struct {
+		DirName string `required:"yes" positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+// NewValidateCmd ...
+func NewValidateCmd() *ValidateCmd {
+	cmd := ValidateCmd{}
+
+	return &cmd
+}
+
+// Execute checks the config files of a beaver project and of every project
+// it inherits.
+func (cmd *ValidateCmd) Execute([]string) error {
+	log := LoggingOptions.Logger()
+	log.Debug().Str("directory", cmd.PositionalArgs.DirName).Msg("starting beaver validate")
+
+	config := runner.NewCmdConfig(log, ".", cmd.PositionalArgs.DirName, true, false, "", "")
+
+	// the inherited paths can use the variables set on the command line
+	overrides, err := overrideVariables(cmd.Args.Set, cmd.Args.SetFile)
+	if err != nil {
+		return err
+	}
+
+	config.Overrides = overrides
+
+	if err := config.Validate(); err != nil {
+		fmt.Println(err)
+
+		return fmt.Errorf("%s is not valid", cmd.PositionalArgs.DirName)
+	}
+
+	fmt.Printf("%s is valid\n", cmd.PositionalArgs.DirName)
+
+	return nil
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"validate",
+		"Check the project config files",
+		"Check the config files of the project and of every project it inherits, reporting all the errors found.",
+		NewValidateCmd(),
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
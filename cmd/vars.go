@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+// VarsCmd is the "vars" command.
+type VarsCmd struct {
+	Args struct {
+		Format string `short:"f" long:"format" description:"output format" choice:"text" choice:"yaml" choice:"json" default:"text"`
+	}
+	PositionalArgs struct {
+		DirName string `required:"yes" positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+// NewVarsCmd ...
+func NewVarsCmd() *VarsCmd {
+	cmd := VarsCmd{}
+
+	return &cmd
+}
+
+// Execute prints every variable path with its final value and the layers
+// that set it.
+func (cmd *VarsCmd) Execute([]string) error {
+	log := LoggingOptions.Logger()
+	log.Debug().Str("directory", cmd.PositionalArgs.DirName).Msg("starting beaver vars")
+
+	config := runner.NewCmdConfig(log, ".", cmd.PositionalArgs.DirName, true, false, "", "")
+
+	if err := config.Load(); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	provenance := config.VariablesProvenance()
+
+	switch cmd.Args.Format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(provenance); err != nil {
+			return fmt.Errorf("cannot encode variables: %w", err)
+		}
+
+		return nil
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+
+		if err := encoder.Encode(provenance); err != nil {
+			return fmt.Errorf("cannot encode variables: %w", err)
+		}
+
+		return encoder.Close()
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("cannot get current working directory: %w", err)
+	}
+
+	for _, p := range provenance {
+		value, err := json.Marshal(p.Value)
+		if err != nil {
+			return fmt.Errorf("cannot encode variable %s: %w", p.Path, err)
+		}
+
+		fmt.Printf("%s = %s\n", p.Path, value)
+
+		for _, origin := range p.Origins {
+			layer := origin.Layer
+			if rel, err := filepath.Rel(cwd, layer); err == nil {
+				layer = rel
+			}
+
+			fmt.Printf("    %-8s %s (%s)\n", origin.Kind, layer, origin.Path)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	if _, err := parser.AddCommand(
+		"vars",
+		"Print the variables and the layers that set them",
+		"Print every variable path with its final value, followed by the layers that set it in merge order.",
+		NewVarsCmd(),
+	); err != nil {
+		Logger.Fatal().Err(err).Msg("error adding command")
+	}
+}
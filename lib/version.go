@@ -6,8 +6,11 @@ import (
 	hv "github.com/hashicorp/go-version"
 )
 
+// ControlVersions checks that the actual beaver version satisfies the desired
+// one, which is either an exact version or a constraint such as
+// `>= 3.2.6, < 4` or `~> 3.2`.
 func ControlVersions(desired, actual string) error {
-	desiredVersion, err := hv.NewVersion(desired)
+	constraints, err := hv.NewConstraint(desired)
 	if err != nil {
 		return fmt.Errorf("failed to parse desired beaver version: %w", err)
 	}
@@ -17,10 +20,10 @@ func ControlVersions(desired, actual string) error {
 		return fmt.Errorf("failed to parse actual beaver version: %w", err)
 	}
 
-	if !desiredVersion.Equal(actualVersion) {
+	if !constraints.Check(actualVersion) {
 		return fmt.Errorf(
-			"desired beaver version is not equal to actual beaver version, %s != %s",
-			desiredVersion.String(), actualVersion.String())
+			"actual beaver version does not satisfy the desired beaver version, %s does not match %q",
+			actualVersion.String(), desired)
 	}
 
 	return nil
@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"sync"
+)
+
+// Cache shares work between the builds of several projects run by the same
+// process: the parsed config layers and the helm dependency builds. It is
+// safe for concurrent use, and a nil *Cache disables sharing.
+type Cache struct {
+	mu    sync.Mutex
+	nodes map[string]*layerNode
+	helm  map[string]*cachedResult
+}
+
+type cachedResult struct {
+	once sync.Once
+	err  error
+}
+
+// NewCache returns an empty *Cache.
+func NewCache() *Cache {
+	return &Cache{
+		nodes: make(map[string]*layerNode),
+		helm:  make(map[string]*cachedResult),
+	}
+}
+
+// layerNode returns the cached layer of a dir, or loads it. Loading errors
+// are not cached.
+func (c *Cache) layerNode(dir string, load func() (*layerNode, error)) (*layerNode, error) {
+	if c == nil {
+		return load()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node, ok := c.nodes[dir]; ok {
+		return node, nil
+	}
+
+	node, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.nodes[dir] = node
+
+	return node, nil
+}
+
+// helmDependencyBuild runs build only once per chart path, concurrent calls
+// for the same path wait for the first one and get its result.
+func (c *Cache) helmDependencyBuild(path string, build func() error) error {
+	if c == nil {
+		return build()
+	}
+
+	c.mu.Lock()
+
+	result, ok := c.helm[path]
+	if !ok {
+		result = &cachedResult{}
+		c.helm[path] = result
+	}
+
+	c.mu.Unlock()
+
+	result.once.Do(func() {
+		result.err = build()
+	})
+
+	return result.err
+}
@@ -1,33 +1,47 @@
 package runner
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/rs/zerolog"
-
-	beaver "orus.io/orus-io/beaver/lib"
 )
 
 const (
-	HelmType = "helm"
-	YttType  = "ytt"
+	HelmType      = "helm"
+	YttType       = "ytt"
+	KustomizeType = "kustomize"
+	ManifestsType = "manifests"
 )
 
+// OverridesLayer is the layer of the CmdConfig.Overrides variables in their
+// origins.
+const OverridesLayer = "<overrides>"
+
 // Ytt is a type alias describing ytt arguments.
 type Ytt []string
 
 type CmdSpec struct {
 	Variables Variables
-	Shas      []*CmdSha
-	Charts    CmdCharts
-	Ytt       Ytt
-	Creates   map[CmdCreateKey]CmdCreate
+	// VariableOrigins: every variable set by the layers, in merge order
+	VariableOrigins []VariableOrigin
+	Shas            []*CmdSha
+	Charts          CmdCharts
+	Ytt             Ytt
+	Creates         map[CmdCreateKey]CmdCreate
+	// VariablesFiles: the variablesFrom files of the layers, in merge order
+	VariablesFiles []string
+	// Env: the environment variables declared by the layers
+	Env map[string]EnvVar
+	// EnvValues: the values of the env.<NAME> variables
+	EnvValues map[string]interface{}
+	// EnvReads: the environment variables read, sorted by name
+	EnvReads []EnvRead
 }
 
 type CmdCreateKey struct {
@@ -72,6 +86,15 @@ type CmdConfig struct {
 	DryRun         bool
 	WithoutHydrate bool
 	Output         string
+	// HydrateMaxDepth: maximum depth of nested variable references, see
+	// HydrateOptions
+	HydrateMaxDepth int
+	// Overrides: variables applied after every layer, eg. set on the command
+	// line
+	Overrides Variables
+	// Cache: shares the parsed layers and the helm dependency builds with
+	// the other projects built by the process, may be nil
+	Cache *Cache
 }
 
 func NewCmdConfig(
@@ -92,18 +115,33 @@ func NewCmdConfig(
 	cmdConfig.Spec.Charts = make(map[string]CmdChart)
 	cmdConfig.Spec.Creates = make(map[CmdCreateKey]CmdCreate)
 	cmdConfig.Spec.Shas = []*CmdSha{}
+	cmdConfig.Spec.Env = make(map[string]EnvVar)
 	cmdConfig.Namespace = namespace
 	cmdConfig.Logger = logger
 
 	return cmdConfig
 }
 
+// Initialize loads the config layers and hydrates the files they reference
+// into tmpDir.
 func (c *CmdConfig) Initialize(tmpDir string) error {
-	if len(c.Layers) != 1 {
-		return fmt.Errorf("you must only have one layer when calling Initialize, found: %d", len(c.Layers))
+	if err := c.Load(); err != nil {
+		return err
 	}
 
-	configLayers := []*Config{}
+	if err := c.hydrate(tmpDir, false); err != nil {
+		return fmt.Errorf("failed to hydrate tmpDir (%s): %w", tmpDir, err)
+	}
+
+	return nil
+}
+
+// Load resolves the config layers and merges them into the spec, without
+// hydrating nor running anything.
+func (c *CmdConfig) Load() error {
+	if len(c.Layers) != 1 {
+		return fmt.Errorf("you must only have one layer when calling Load, found: %d", len(c.Layers))
+	}
 
 	resolvedConfigDir := filepath.Join(c.RootDir, c.Layers[0])
 
@@ -112,32 +150,22 @@ func (c *CmdConfig) Initialize(tmpDir string) error {
 		return fmt.Errorf("failed to find abs() for %s: %w", resolvedConfigDir, err)
 	}
 
-	dirs := []string{absConfigDir}
-	dirMap := make(map[string]interface{})
-
-	// otherwise, first layer will be present twice
-	c.Layers = []string{}
+	graph := newLayerGraph(c.newConfigFromDir, c.Cache)
+	graph.overrides = c.Overrides
 
-	for len(dirs) > 0 {
-		var newDirs []string
-
-		for _, dir := range dirs {
-			dirs, cl, err := c.addConfDir(dir, dirMap, configLayers)
-			if err != nil {
-				return err
-			}
-
-			configLayers = cl
-
-			newDirs = append(newDirs, dirs...)
-		}
-
-		dirs = newDirs
+	linear, err := graph.linearize(absConfigDir)
+	if err != nil {
+		return err
 	}
 
-	// reverse our layers list
-	for i, j := 0, len(configLayers)-1; i < j; i, j = i+1, j-1 {
-		configLayers[i], configLayers[j] = configLayers[j], configLayers[i]
+	// the linearization goes from the most specific layer to the most
+	// generic one, layers are applied the other way around
+	c.Layers = make([]string, 0, len(linear))
+	configLayers := make([]*Config, 0, len(linear))
+
+	for i := len(linear) - 1; i >= 0; i-- {
+		c.Layers = append(c.Layers, linear[i])
+		configLayers = append(configLayers, graph.nodes[linear[i]].config)
 	}
 
 	for _, config := range configLayers {
@@ -145,10 +173,18 @@ func (c *CmdConfig) Initialize(tmpDir string) error {
 			c.Namespace = config.NameSpace
 		}
 
-		c.MergeVariables(config)
+		if err := c.remove(config); err != nil {
+			return fmt.Errorf("%s: %w", config.File, err)
+		}
+
+		if err := c.MergeVariables(config); err != nil {
+			return fmt.Errorf("%s: %w", config.File, err)
+		}
 
 		for k, chart := range config.Charts {
-			c.Spec.Charts[k] = CmdChartFromChart(chart)
+			cmdChart := CmdChartFromChart(chart)
+			cmdChart.Dir = config.Dir
+			c.Spec.Charts[k] = cmdChart
 		}
 
 		for _, k := range config.Creates {
@@ -160,113 +196,104 @@ func (c *CmdConfig) Initialize(tmpDir string) error {
 		}
 
 		for _, sha := range config.Sha {
-			cmdSha := CmdSha{Key: sha.Key, Resource: sha.Resource}
-			c.Spec.Shas = append(c.Spec.Shas, &cmdSha)
+			c.setSha(CmdSha{Key: sha.Key, Resource: sha.Resource})
+		}
+
+		for name, envVar := range config.Env {
+			c.Spec.Env[name] = envVar
 		}
 	}
 
-	for i, j := 0, len(c.Layers)-1; i < j; i, j = i+1, j-1 {
-		c.Layers[i], c.Layers[j] = c.Layers[j], c.Layers[i]
+	if err := c.overlayVariables(OverridesLayer, c.Overrides); err != nil {
+		return err
 	}
 
-	c.populate()
+	if err := c.readEnv(); err != nil {
+		return err
+	}
 
-	if err := c.hydrate(tmpDir, false); err != nil {
-		return fmt.Errorf("failed to hydrate tmpDir (%s): %w", tmpDir, err)
+	if err := c.resolveVariables(); err != nil {
+		return err
+	}
+
+	if err := c.hydrateSpec(); err != nil {
+		return err
 	}
 
+	c.populate()
+
 	return nil
 }
 
-func (c *CmdConfig) addConfDir(
-	dir string,
-	dirMap map[string]interface{},
-	configLayers []*Config,
-) (
-	[]string,
-	[]*Config,
-	error,
-) {
-	// guard against recursive inherit loops
-	_, present := dirMap[dir]
-	if present {
-		var dirList []string
-		for k := range dirMap {
-			dirList = append(dirList, k)
+// remove deletes the inherited entries listed in the remove block of a
+// config.
+func (c *CmdConfig) remove(config *Config) error {
+	for _, name := range config.Remove.Variables {
+		if err := c.Spec.Variables.Remove(name); err != nil {
+			return err
 		}
 
-		return nil, configLayers, fmt.Errorf("recursive inherit loop detected: dirs %s->%s", strings.Join(dirList, "->"), dir)
-	}
-
-	config, err := c.newConfigFromDir(dir)
-	if err != nil {
-		return nil, configLayers, fmt.Errorf("failed to create config from %s: %w", dir, err)
-	}
+		// the removed variable may be defined again by a later layer
+		origins := c.Spec.VariableOrigins[:0]
 
-	if config == nil {
-		if len(c.Layers) == 1 {
-			return nil, configLayers, fmt.Errorf("beaver file not found in directory: %s", dir)
+		for _, origin := range c.Spec.VariableOrigins {
+			if origin.Path != name && !strings.HasPrefix(origin.Path, name+".") {
+				origins = append(origins, origin)
+			}
 		}
 
-		return nil, configLayers, nil
+		c.Spec.VariableOrigins = origins
 	}
 
-	config.Dir = dir
-	if err := config.Absolutize(dir); err != nil {
-		return nil, configLayers, fmt.Errorf("failed to absolutize config from dir: %s, %w", dir, err)
-	}
-
-	// first config dir must return a real config...
-	// others can be skipped
-	if config == nil && len(configLayers) == 0 {
-		return nil, configLayers, fmt.Errorf("failed to find config in dir: %s", dir)
-	}
+	for _, name := range config.Remove.Charts {
+		if _, ok := c.Spec.Charts[name]; !ok {
+			return fmt.Errorf("cannot remove chart %s: it is not inherited", name)
+		}
 
-	absDir, err := filepath.Abs(dir)
-	if err != nil {
-		return nil, configLayers, fmt.Errorf("failed to find abs() for %s: %w", dir, err)
+		delete(c.Spec.Charts, name)
 	}
 
-	c.Layers = append(c.Layers, absDir)
-
-	if config.BeaverVersion != "" && beaver.Version() != "" {
-		if err := beaver.ControlVersions(config.BeaverVersion, beaver.Version()); err != nil {
-			return nil, nil, err
+	for _, key := range config.Remove.Sha {
+		index := c.shaIndex(key)
+		if index == -1 {
+			return fmt.Errorf("cannot remove sha %s: it is not inherited", key)
 		}
+
+		c.Spec.Shas = append(c.Spec.Shas[:index], c.Spec.Shas[index+1:]...)
 	}
 
-	configLayers = append(configLayers, config)
+	for _, create := range config.Remove.Creates {
+		key := CmdCreateKey(create)
+		if _, ok := c.Spec.Creates[key]; !ok {
+			return fmt.Errorf("cannot remove create %s %s: it is not inherited", create.Type, create.Name)
+		}
 
-	if config == nil || (len(config.Inherits) == 0 && config.Inherit == "") {
-		// weNeedToGoDeeper = false
-		return nil, configLayers, nil
+		delete(c.Spec.Creates, key)
 	}
 
-	newDirs := []string{}
-
-	for _, inherit := range config.Inherits {
-		resolvedDir := filepath.Join(absDir, inherit)
+	return nil
+}
 
-		newDir, err := filepath.Abs(resolvedDir)
-		if err != nil {
-			return nil, configLayers, fmt.Errorf("failed to find abs() for %s: %w", resolvedDir, err)
-		}
+// setSha adds a sha entry, or replaces the one having the same key.
+func (c *CmdConfig) setSha(sha CmdSha) {
+	if index := c.shaIndex(sha.Key); index != -1 {
+		c.Spec.Shas[index] = &sha
 
-		newDirs = append(newDirs, newDir)
+		return
 	}
 
-	if config.Inherit != "" {
-		resolvedDir := filepath.Join(absDir, config.Inherit)
+	c.Spec.Shas = append(c.Spec.Shas, &sha)
+}
 
-		newDir, err := filepath.Abs(resolvedDir)
-		if err != nil {
-			return nil, configLayers, fmt.Errorf("failed to find abs() for %s: %w", resolvedDir, err)
+// shaIndex returns the index of the sha entry having the given key, or -1.
+func (c *CmdConfig) shaIndex(key string) int {
+	for i, sha := range c.Spec.Shas {
+		if sha.Key == key {
+			return i
 		}
-
-		newDirs = append(newDirs, newDir)
 	}
 
-	return newDirs, configLayers, nil
+	return -1
 }
 
 func (c *CmdConfig) newConfigFromDir(dir string) (*Config, error) {
@@ -295,20 +322,18 @@ func (c *CmdConfig) SetShas(buildDir string) error {
 func (s *CmdSha) SetSha(buildDir string) error {
 	fPath := filepath.Join(buildDir, s.Resource)
 
-	f, err := os.Open(fPath)
+	content, err := os.ReadFile(fPath)
 	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", fPath, err)
-	}
-
-	defer f.Close()
-
-	hash := sha256.New()
-
-	if _, err := io.Copy(hash, f); err != nil {
 		return fmt.Errorf("failed to read %s: %w", fPath, err)
 	}
 
-	s.Sha = hex.EncodeToString(hash.Sum(nil))
+	// the sha is the one of the rendered resource, whose escaped tags are
+	// unescaped by the last hydration
+	content = bytes.ReplaceAll(content, []byte(escapedTag), []byte("<["))
+	content = bytes.ReplaceAll(content, []byte(escapedTagPlaceholder), []byte("<["))
+
+	hash := sha256.Sum256(content)
+	s.Sha = hex.EncodeToString(hash[:])
 
 	return nil
 }
@@ -336,48 +361,49 @@ type CmdChart struct {
 	Path      string
 	Name      string
 	Namespace string
+	// Dir: the directory of the layer which declares the chart, a relative
+	// path is relative to it
+	Dir string
 	// Must be castable into bool (0,1,true,false).
 	Disabled        string
 	ValuesFileNames []string
+	// Include, Exclude: glob patterns selecting the files of a manifests
+	// chart
+	Include []string
+	Exclude []string
+	// Command: the command rendering an exec chart
+	Command []string
+	// Set, SetString, KubeVersion, APIVersions, IncludeCrds, SkipTests,
+	// SkipCrds, PostRenderer, ExtraArgs: the options of a helm chart
+	Set          map[string]string
+	SetString    map[string]string
+	KubeVersion  string
+	APIVersions  []string
+	IncludeCrds  bool
+	SkipTests    bool
+	SkipCrds     bool
+	PostRenderer string
+	ExtraArgs    []string
 }
 
 // BuildArgs is in charge of producing the argument list to be provided
 // to the cmd.
 func (c CmdChart) BuildArgs(n, ns string) ([]string, error) {
-	var name string
-
-	var namespace string
-
-	args := []string{}
-
-	if c.Name != "" {
-		name = c.Name
-	} else {
-		name = n
-	}
-
-	if c.Namespace != "" {
-		namespace = c.Namespace
-	} else {
-		namespace = ns
+	engine, ok := LookupEngine(c.Type)
+	if !ok {
+		return nil, fmt.Errorf("unsupported chart %s type: %q", c.Path, c.Type)
 	}
 
-	switch c.Type {
-	case HelmType:
-		// helm template name vendor/helm/mychart/ --namespace ns1 -f base.values.yaml -f ns.yaml -f ns.values.yaml
-		args = append(args, "template", name, c.Path, "--namespace", namespace)
-
-	case YttType:
-		args = append(args, "-f", c.Path)
-	default:
-		return nil, fmt.Errorf("unsupported chart %s type: %q", c.Path, c.Type)
+	command, err := engine.Command(newChartContext(n, c, ns))
+	if err != nil {
+		return nil, err
 	}
 
-	for _, vFile := range c.ValuesFileNames {
-		args = append(args, "-f", vFile)
+	if command == nil {
+		return nil, fmt.Errorf("%s chart %s is rendered by beaver, it has no command", c.Type, n)
 	}
 
-	return args, nil
+	return command.Args, nil
 }
 
 func CmdChartFromChart(c Chart) CmdChart {
@@ -388,6 +414,18 @@ func CmdChartFromChart(c Chart) CmdChart {
 		Namespace:       c.Namespace,
 		Disabled:        c.Disabled,
 		ValuesFileNames: nil,
+		Include:         c.Include,
+		Exclude:         c.Exclude,
+		Command:         c.Command,
+		Set:             c.Set,
+		SetString:       c.SetString,
+		KubeVersion:     c.KubeVersion,
+		APIVersions:     c.APIVersions,
+		IncludeCrds:     c.IncludeCrds,
+		SkipTests:       c.SkipTests,
+		SkipCrds:        c.SkipCrds,
+		PostRenderer:    c.PostRenderer,
+		ExtraArgs:       c.ExtraArgs,
 	}
 }
 
@@ -398,6 +436,11 @@ func (c *CmdConfig) prepareVariables(doSha bool) (map[string]interface{}, error)
 	}
 
 	variables["namespace"] = c.Namespace
+
+	if c.Spec.EnvValues != nil {
+		variables["env"] = c.Spec.EnvValues
+	}
+
 	shavars := map[string]interface{}{}
 
 	for _, sha := range c.Spec.Shas {
@@ -417,11 +460,214 @@ func (c *CmdConfig) prepareVariables(doSha bool) (map[string]interface{}, error)
 	return variables, nil
 }
 
+// resolveVariables expands the references between variables once all the
+// layers are merged, so that a layer can override a variable used by the
+// others. A reference to a whole variable keeps its type. References to
+// `env` are resolved too, references to other values, such as `sha` or
+// `namespace`, are left to the hydration.
+func (c *CmdConfig) resolveVariables() error {
+	variables := make(map[string]interface{}, len(c.Spec.Variables))
+	for _, variable := range c.Spec.Variables {
+		variables[variable.Name] = variable.Value
+	}
+
+	if c.Spec.EnvValues != nil {
+		variables["env"] = c.Spec.EnvValues
+	}
+
+	x := c.hydrateOptions(false).expansion(variables)
+	x.keepUnknown = true
+
+	resolved := make(Variables, 0, len(c.Spec.Variables))
+
+	for _, variable := range c.Spec.Variables {
+		value, err := x.resolveValue(variable.Name, variable.Value, nil)
+		if err != nil {
+			return fmt.Errorf("cannot resolve variable %s: %w", variable.Name, err)
+		}
+
+		resolved = append(resolved, Variable{Name: variable.Name, Value: value})
+	}
+
+	c.Spec.Variables = resolved
+
+	return nil
+}
+
+// hydrateSpec expands the variables found in the charts and in the create
+// commands once the layers are merged, then makes the chart paths absolute.
+func (c *CmdConfig) hydrateSpec() error {
+	variables, err := c.prepareVariables(false)
+	if err != nil {
+		return fmt.Errorf("cannot prepare variables: %w", err)
+	}
+
+	// these values are not hydrated again
+	options := c.hydrateOptions(true)
+
+	hydrate := func(s string) (string, error) {
+		var buf bytes.Buffer
+		if err := options.HydrateString(s, &buf, variables); err != nil {
+			return "", err
+		}
+
+		return buf.String(), nil
+	}
+
+	// the lists and maps are shared with the layer, which may be cached
+	hydrateList := func(list []string) ([]string, error) {
+		if list == nil {
+			return nil, nil
+		}
+
+		result := make([]string, len(list))
+
+		for i, s := range list {
+			if result[i], err = hydrate(s); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	}
+
+	hydrateMap := func(m map[string]string) (map[string]string, error) {
+		if m == nil {
+			return nil, nil
+		}
+
+		result := make(map[string]string, len(m))
+
+		for key, s := range m {
+			if result[key], err = hydrate(s); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+
+		return result, nil
+	}
+
+	for name, chart := range c.Spec.Charts {
+		for _, field := range []*string{
+			&chart.Path, &chart.Name, &chart.Namespace, &chart.KubeVersion, &chart.PostRenderer,
+		} {
+			if *field, err = hydrate(*field); err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
+		}
+
+		for _, field := range []struct {
+			name string
+			list *[]string
+		}{{"command", &chart.Command}, {"apiVersions", &chart.APIVersions}, {"extraArgs", &chart.ExtraArgs}} {
+			if *field.list, err = hydrateList(*field.list); err != nil {
+				return fmt.Errorf("chart %s: %s: %w", name, field.name, err)
+			}
+		}
+
+		for _, field := range []struct {
+			name   string
+			values *map[string]string
+		}{{"set", &chart.Set}, {"setString", &chart.SetString}} {
+			if *field.values, err = hydrateMap(*field.values); err != nil {
+				return fmt.Errorf("chart %s: %s: %w", name, field.name, err)
+			}
+		}
+
+		path := chart.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(chart.Dir, path)
+		}
+
+		if chart.Path, err = filepath.Abs(path); err != nil {
+			return fmt.Errorf("failed to find abs() for %s: %w", path, err)
+		}
+
+		c.Spec.Charts[name] = chart
+	}
+
+	creates := make(map[CmdCreateKey]CmdCreate, len(c.Spec.Creates))
+
+	for key, create := range c.Spec.Creates {
+		name, err := hydrate(key.Name)
+		if err != nil {
+			return fmt.Errorf("create %s %s: %w", key.Type, key.Name, err)
+		}
+
+		// the args are shared with the layer, which may be cached
+		args := make([]Arg, 0, len(create.Args))
+
+		for _, arg := range create.Args {
+			value, err := hydrate(arg.Value)
+			if err != nil {
+				return fmt.Errorf("create %s %s: arg %s: %w", key.Type, key.Name, arg.Flag, err)
+			}
+
+			args = append(args, Arg{Flag: arg.Flag, Value: value})
+		}
+
+		hydrated := CmdCreateKey{Type: key.Type, Name: name}
+		if _, ok := creates[hydrated]; ok {
+			return fmt.Errorf("create %s %s is declared twice once hydrated", key.Type, name)
+		}
+
+		creates[hydrated] = CmdCreate{Dir: create.Dir, Args: args}
+	}
+
+	c.Spec.Creates = creates
+
+	return nil
+}
+
+// hydrateOptions returns the options of the hydrations, unescape must only be
+// set for the last one of the build.
+func (c *CmdConfig) hydrateOptions(unescape bool) HydrateOptions {
+	return HydrateOptions{Unescape: unescape, MaxDepth: c.HydrateMaxDepth}
+}
+
 // MergeVariables takes a config (from a file, not a cmd one) and import its
 // variables into the current cmdconfig by replacing old ones
-// and adding the new ones.
-func (c *CmdConfig) MergeVariables(other *Config) {
-	c.Spec.Variables.Overlay(other.Variables...)
+// and adding the new ones. The variablesFrom files are merged first.
+func (c *CmdConfig) MergeVariables(other *Config) error {
+	for _, path := range other.VariablesFrom {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(other.Dir, path)
+		}
+
+		variables, err := ReadVariablesFile(path)
+		if err != nil {
+			return err
+		}
+
+		c.Spec.VariablesFiles = append(c.Spec.VariablesFiles, path)
+
+		if err := c.overlayVariables(path, variables); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return c.overlayVariables(other.Dir, other.LayerVariables())
+}
+
+// overlayVariables overlays the variables of a layer on the spec ones.
+func (c *CmdConfig) overlayVariables(layer string, variables Variables) error {
+	for _, variable := range variables {
+		c.Spec.VariableOrigins = append(c.Spec.VariableOrigins, VariableOrigin{
+			Path:  variable.Name,
+			Layer: layer,
+			Kind:  c.Spec.originKind(variable),
+		})
+	}
+
+	// the layer may be shared with other projects, and Overlay modifies
+	// the values in place
+	copies := make(Variables, 0, len(variables))
+	for _, variable := range variables {
+		variable.Value = CopyValue(variable.Value)
+		copies = append(copies, variable)
+	}
+
+	return c.Spec.Variables.Overlay(copies...)
 }
 
 // hydrate expands templated variables in our config with concrete values.
@@ -432,7 +678,7 @@ func (c *CmdConfig) hydrate(dirName string, doSha bool) error {
 	}
 
 	for key, chart := range c.Spec.Charts {
-		paths, err := hydrateFiles(dirName, variables, chart.ValuesFileNames, c.WithoutHydrate)
+		paths, err := c.hydrateOptions(false).hydrateFiles(dirName, variables, chart.ValuesFileNames, c.WithoutHydrate)
 		if err != nil {
 			return err
 		}
@@ -441,7 +687,7 @@ func (c *CmdConfig) hydrate(dirName string, doSha bool) error {
 		c.Spec.Charts[key] = chart
 	}
 
-	paths, err := hydrateFiles(dirName, variables, c.Spec.Ytt, c.WithoutHydrate)
+	paths, err := c.hydrateOptions(false).hydrateFiles(dirName, variables, c.Spec.Ytt, c.WithoutHydrate)
 	if err != nil {
 		return err
 	}
@@ -1,9 +1,11 @@
 package runner_test
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -64,3 +66,511 @@ metadata:
 
 	assert.Equal(t, expected, string(content))
 }
+
+func TestInspect(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs(fixtures)
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, envNS1, false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	inspection := c.Inspect()
+
+	assert.Equal(t, "ns1", inspection.Namespace)
+	require.Len(t, inspection.Layers, 2)
+	assert.True(t, strings.HasSuffix(inspection.Layers[0], "base"))
+	assert.Equal(t, "k8s.orus.io", inspection.Variables["VAULT_KV"])
+	assert.Empty(t, inspection.VariablesFiles)
+
+	postgres, ok := inspection.Charts["postgres"]
+	require.True(t, ok)
+	assert.Equal(t, "helm", postgres.Type)
+	// Load does not hydrate: value files are the original ones
+	assert.Equal(
+		t,
+		[]string{
+			filepath.Join(absConfigDir, "base", "postgres.yml"),
+			filepath.Join(absConfigDir, envNS1, "postgres.yaml"),
+		},
+		postgres.ValueFiles,
+	)
+
+	require.Len(t, inspection.Creates, 1)
+	assert.Equal(t, "xbus-pipelines", inspection.Creates[0].Name)
+}
+
+func TestVariablesProvenance(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs(fixtures)
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, envNS1, false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	base := filepath.Join(absConfigDir, "base")
+	env := filepath.Join(absConfigDir, envNS1)
+
+	provenance := make(map[string]runner.VariableProvenance)
+	for _, p := range c.VariablesProvenance() {
+		provenance[p.Path] = p
+	}
+
+	require.Len(t, provenance, 4)
+
+	assert.Equal(t, runner.VariableProvenance{
+		Path:  "VAULT_KV",
+		Value: "k8s.orus.io",
+		Origins: []runner.VariableOrigin{
+			{Path: "VAULT_KV", Layer: base, Kind: runner.OriginDefine},
+			{Path: "VAULT_KV", Layer: env, Kind: runner.OriginReplace},
+		},
+	}, provenance["VAULT_KV"])
+
+	assert.Equal(t, runner.VariableProvenance{
+		Path:  "test-nested.nested-value1",
+		Value: "another value",
+		Origins: []runner.VariableOrigin{
+			{Path: "test-nested", Layer: base, Kind: runner.OriginDefine},
+			{Path: "test-nested.nested-value1", Layer: env, Kind: runner.OriginPartial},
+		},
+	}, provenance["test-nested.nested-value1"])
+
+	assert.Equal(t, runner.VariableProvenance{
+		Path:  "test-nested.nested-value2",
+		Value: "Value2",
+		Origins: []runner.VariableOrigin{
+			{Path: "test-nested", Layer: base, Kind: runner.OriginDefine},
+		},
+	}, provenance["test-nested.nested-value2"])
+}
+
+func TestInheritDiamond(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fInheritDiamond")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	// base is loaded once, before both a and b, and a wins over b because
+	// it is declared first
+	assert.Equal(
+		t,
+		[]string{
+			filepath.Join(absConfigDir, "base"),
+			filepath.Join(absConfigDir, "b"),
+			filepath.Join(absConfigDir, "a"),
+			filepath.Join(absConfigDir, "env"),
+		},
+		c.Layers,
+	)
+	assert.Equal(t, "a", c.Spec.Variables.GetD("who", nil))
+	assert.Len(t, c.Spec.Charts["demo"].ValuesFileNames, 1)
+
+	var baseOrigins int
+
+	for _, origin := range c.Spec.VariableOrigins {
+		if origin.Layer == filepath.Join(absConfigDir, "base") {
+			baseOrigins++
+		}
+	}
+
+	assert.Equal(t, 1, baseOrigins)
+
+	// the layers are already resolved
+	require.EqualError(t, c.Load(), "you must only have one layer when calling Load, found: 4")
+}
+
+func TestInheritDeep(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fInheritDeep")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	// the whole a branch wins over the b branch, so a1 overrides b even if
+	// a1 is deeper in the inheritance tree
+	assert.Equal(
+		t,
+		[]string{
+			filepath.Join(absConfigDir, "b1"),
+			filepath.Join(absConfigDir, "b"),
+			filepath.Join(absConfigDir, "a1"),
+			filepath.Join(absConfigDir, "a"),
+			filepath.Join(absConfigDir, "env"),
+		},
+		c.Layers,
+	)
+	assert.Equal(t, "a1", c.Spec.Variables.GetD("who", nil))
+	assert.Equal(t, 2, c.Spec.Variables.GetD("replicas", nil))
+	assert.Equal(t, "deep", c.Namespace)
+}
+
+func TestInheritCycle(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fInheritCycle")
+	require.NoError(t, err)
+
+	a := filepath.Join(absConfigDir, "a")
+	b := filepath.Join(absConfigDir, "b")
+	self := filepath.Join(absConfigDir, "self")
+
+	for _, tt := range []struct {
+		dir      string
+		expected string
+	}{
+		{"a", a + " -> " + b + " -> " + a},
+		{"b", b + " -> " + a + " -> " + b},
+		{"self", self + " -> " + self},
+	} {
+		t.Run(tt.dir, func(t *testing.T) {
+			c := runner.NewCmdConfig(tl.Logger(), absConfigDir, tt.dir, false, false, "", "")
+
+			err := c.Load()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "recursive inherit loop detected: "+tt.expected)
+		})
+	}
+}
+
+func TestLoadSharedCache(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs(fixtures)
+	require.NoError(t, err)
+
+	cache := runner.NewCache()
+
+	for range 2 {
+		env := runner.NewCmdConfig(tl.Logger(), absConfigDir, envNS1, false, false, "", "")
+		env.Cache = cache
+
+		require.NoError(t, env.Load())
+		assert.Equal(t, "another value", env.Spec.Variables.GetD("test-nested.nested-value1", nil))
+	}
+
+	// the base layer is shared with ns1, which overrides one of its values
+	base := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", false, false, "", "")
+	base.Cache = cache
+
+	require.NoError(t, base.Load())
+	assert.Equal(t, "Value1", base.Spec.Variables.GetD("test-nested.nested-value1", nil))
+	assert.Equal(t, "orus.io", base.Spec.Variables.GetD("VAULT_KV", nil))
+}
+
+func TestEscapedTags(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fEscape")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, ".", false, false, "", "")
+
+	require.NoError(t, c.Initialize(t.TempDir()))
+
+	for _, tt := range []struct {
+		chart    string
+		hydrated string
+		final    string
+	}{
+		{
+			chart:    "escaped",
+			hydrated: `script: echo '\<[who]>' is beaver`,
+			final:    `script: echo '<[who]>' is beaver`,
+		},
+		{
+			// a no-hydrate file is rendered verbatim, comments included
+			chart:    "raw",
+			hydrated: "# beaver: no-hydrate\n#@data/values\n---\nscript: echo '",
+			final:    "# beaver: no-hydrate\n#@data/values\n---\nscript: echo '<[who]>' and '\\<[who]>'\n",
+		},
+	} {
+		t.Run(tt.chart, func(t *testing.T) {
+			require.Len(t, c.Spec.Charts[tt.chart].ValuesFileNames, 1)
+
+			content, err := os.ReadFile(c.Spec.Charts[tt.chart].ValuesFileNames[0])
+			require.NoError(t, err)
+
+			// the escaped tags are kept until the last hydration
+			assert.Contains(t, string(content), tt.hydrated)
+
+			var final bytes.Buffer
+
+			options := runner.HydrateOptions{Unescape: true}
+			require.NoError(t, options.Hydrate(content, &final, map[string]interface{}{"who": "beaver"}))
+			assert.Contains(t, final.String(), tt.final)
+		})
+	}
+
+	// the sha of a resource is the one of its rendered content
+	buildDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "ConfigMap.v1.demo.yaml"), []byte("a: \\<[x]>\n"), 0o600))
+
+	sha := runner.CmdSha{Key: "configmap", Resource: "ConfigMap.v1.demo.yaml"}
+	require.NoError(t, sha.SetSha(buildDir))
+	assert.Equal(t, "480f0b3ea2e83574278b2b858b3c1e71c1d8a6cdbc46e016b2f5a345400906bd", sha.Sha)
+}
+
+func TestResolveVariables(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fVarRefs")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	assert.Equal(t, "api.prod.example.com", c.Spec.Variables.GetD("api_host", nil))
+	assert.Equal(t, 3, c.Spec.Variables.GetD("replicas", nil))
+	assert.Equal(
+		t,
+		[]interface{}{"https://api.prod.example.com", "https://www.PROD.EXAMPLE.COM"},
+		c.Spec.Variables.GetD("urls", nil),
+	)
+	// namespace and sha are only known when hydrating
+	assert.Equal(t, "<[namespace]>-<[sha.configmap | trunc 8]>", c.Spec.Variables.GetD("release", nil))
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "cycle", false, false, "", "")
+
+	require.ErrorContains(t, c.Load(), "recursive variable reference: domain -> api_host -> domain")
+}
+
+func TestRemove(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fRemove")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	assert.Equal(t, runner.Variables{
+		{Name: "labels", Value: map[string]interface{}{"team": "beaver"}},
+	}, c.Spec.Variables)
+
+	assert.Contains(t, c.Spec.Charts, "postgres")
+	assert.NotContains(t, c.Spec.Charts, "debug")
+
+	assert.Equal(t, []*runner.CmdSha{{Key: "configmap", Resource: "ConfigMap.v1.demo-env.yaml"}}, c.Spec.Shas)
+
+	assert.Contains(t, c.Spec.Creates, runner.CmdCreateKey{Type: "configmap", Name: "pipelines"})
+	assert.NotContains(t, c.Spec.Creates, runner.CmdCreateKey{Type: "configmap", Name: "debug"})
+
+	// the origins of the removed variable are dropped with it
+	assert.Equal(t, []runner.VariableOrigin{
+		{Path: "labels", Layer: filepath.Join(absConfigDir, "base"), Kind: runner.OriginDefine},
+	}, c.Spec.VariableOrigins)
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "missing", false, false, "", "")
+
+	require.ErrorContains(t, c.Load(), "cannot remove chart redis: it is not inherited")
+}
+
+func TestRemoveValidate(t *testing.T) {
+	requireInvalid(t, "remove",
+		`3:5: remove: invalid variable name "labels..team"`,
+		`4:5: remove: invalid variable name ".labels"`,
+		"6:5: remove: create #0: type and name are required",
+	)
+}
+
+func TestRemoveVariableOrigins(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fRemove")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "redefine", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	// a removed variable defined again starts a new history
+	assert.Equal(t, runner.Variables{
+		{Name: "labels", Value: map[string]interface{}{"team": "otter"}},
+	}, c.Spec.Variables)
+	assert.Equal(t, []runner.VariableOrigin{
+		{Path: "labels", Layer: filepath.Join(absConfigDir, "redefine"), Kind: runner.OriginDefine},
+	}, c.Spec.VariableOrigins)
+}
+
+func TestVariablesFrom(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fVarsFrom")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+	c.Overrides = runner.Variables{
+		{Name: "image.tag", Value: "1.27"},
+		{Name: "build", Value: 42},
+	}
+
+	require.NoError(t, c.Load())
+
+	assert.Equal(t, runner.Variables{
+		{Name: "replicas", Value: 1},
+		{Name: "image", Value: map[string]interface{}{"repository": "nginx", "tag": "1.27"}},
+		{Name: "labels", Value: map[string]interface{}{"env": "prod"}},
+		{Name: "build", Value: 42},
+	}, c.Spec.Variables)
+
+	assert.Equal(t, []string{
+		filepath.Join(absConfigDir, "base", "common.yaml"),
+		filepath.Join(absConfigDir, "env", "image.json"),
+	}, c.Spec.VariablesFiles)
+
+	var layers []string
+
+	for _, origin := range c.Spec.VariableOrigins {
+		if origin.Path == "image.tag" || origin.Path == "image" {
+			layers = append(layers, origin.Layer)
+		}
+	}
+
+	assert.Equal(t, []string{
+		filepath.Join(absConfigDir, "base", "common.yaml"),
+		filepath.Join(absConfigDir, "env", "image.json"),
+		runner.OverridesLayer,
+	}, layers)
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+	c.Overrides = runner.Variables{{Name: "replicas.count", Value: 3}}
+
+	require.ErrorContains(t, c.Load(), "cannot set variable replicas.count: replicas is a int, not a dict nor a list")
+
+	// an absolute path is not relative to the layer
+	common := filepath.Join(absConfigDir, "base", "common.yaml")
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.MergeVariables(&runner.Config{Dir: t.TempDir(), VariablesFrom: []string{common}}))
+	assert.Equal(t, []string{common}, c.Spec.VariablesFiles)
+	assert.Equal(t, "nginx", c.Spec.Variables.GetD("image.repository", nil))
+}
+
+func TestMergeVariables(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fMerge")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	assert.Equal(t, runner.Variables{
+		{Name: "labels", Value: map[string]interface{}{
+			"team": "backend",
+			"env":  "prod",
+			"tier": map[string]interface{}{"name": "api", "level": 2},
+		}},
+		{Name: "hosts", Value: []interface{}{"b.example.com", "a.example.com", "c.example.com"}},
+		{Name: "env", Value: []interface{}{
+			map[string]interface{}{"name": "LOG_LEVEL", "value": "warning"},
+			map[string]interface{}{"name": "PORT", "value": "8080"},
+			map[string]interface{}{"name": "DEBUG", "value": "false"},
+		}},
+	}, c.Spec.Variables)
+
+	var kinds []string
+
+	for _, origin := range c.Spec.VariableOrigins {
+		if origin.Layer == filepath.Join(absConfigDir, "env") {
+			kinds = append(kinds, origin.Path+" "+origin.Kind)
+		}
+	}
+
+	// the variables block is applied first, then the merge, append and
+	// prepend blocks
+	assert.Equal(t, []string{"env merge", "labels merge", "hosts merge", "hosts merge"}, kinds)
+}
+
+func TestEnv(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fEnv")
+	require.NoError(t, err)
+
+	t.Setenv("BEAVER_TEST_COMMIT", "0123456789abcdef")
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	assert.Equal(t, "registry.example.com/beaver:01234567", c.Spec.Variables.GetD("image", nil))
+	assert.Equal(t, false, c.Spec.Variables.GetD("debug", nil))
+	assert.Equal(t, []runner.EnvRead{
+		{Name: "BEAVER_TEST_COMMIT", Source: runner.EnvFromEnvironment},
+		{Name: "BEAVER_TEST_DEBUG", Source: runner.EnvUnset},
+		{Name: "BEAVER_TEST_REGISTRY", Source: runner.EnvFromDefault},
+	}, c.Inspect().Env)
+
+	// only the declared environment variables are readable
+	t.Setenv("BEAVER_TEST_OTHER", "other")
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+	c.Overrides = runner.Variables{{Name: "other", Value: "<[env.BEAVER_TEST_OTHER]>"}}
+
+	require.ErrorContains(t, c.Load(), "tag not found: env.BEAVER_TEST_OTHER")
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "conflict", false, false, "", "")
+
+	require.ErrorContains(t, c.Load(), "variable env conflicts with the env section")
+
+	t.Setenv("BEAVER_TEST_COMMIT", "")
+	os.Unsetenv("BEAVER_TEST_COMMIT") //nolint:errcheck
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.ErrorContains(t, c.Load(), "environment variable BEAVER_TEST_COMMIT is required")
+}
+
+func TestEnvValidate(t *testing.T) {
+	requireInvalid(t, "envVars",
+		"2:14: env CI-COMMIT: invalid environment variable name",
+		"4:5: env IMAGE_TAG: a required variable cannot have a default",
+	)
+}
+
+func TestHydrateSpec(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fHydrateSpec")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	require.Len(t, c.Layers, 2)
+	assert.Equal(t, filepath.Join(absConfigDir, "base"), c.Layers[0])
+
+	postgres := c.Spec.Charts["postgres"]
+	assert.Equal(t, filepath.Join(absConfigDir, "vendor", "postgresql-13.2.1"), postgres.Path)
+	assert.Equal(t, "prod-pg", postgres.Name)
+	assert.Equal(t, "prod-db", postgres.Namespace)
+
+	create, ok := c.Spec.Creates[runner.CmdCreateKey{Type: "configmap", Name: "prod-config"}]
+	require.True(t, ok)
+	assert.Equal(t, []runner.Arg{{Flag: "--from-file", Value: "config/prod"}}, create.Args)
+
+	// the inherited path can be chosen on the command line
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", false, false, "", "")
+	c.Overrides = runner.Variables{{Name: "base_dir", Value: "missing"}}
+
+	require.ErrorContains(t, c.Load(), filepath.Join(absConfigDir, "missing"))
+
+	// and validated with the same variables
+	require.NoError(t, runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", true, false, "", "").Validate())
+	require.ErrorContains(t, c.Validate(), filepath.Join(absConfigDir, "missing"))
+
+	// or read from the environment variables of the project
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "fromEnv", false, false, "", "")
+
+	require.NoError(t, c.Load())
+	assert.Equal(t, filepath.Join(absConfigDir, "base"), c.Layers[0])
+
+	t.Setenv("HYDRATE_SPEC_BASE", "missing")
+
+	c = runner.NewCmdConfig(tl.Logger(), absConfigDir, "fromEnv", false, false, "", "")
+
+	require.ErrorContains(t, c.Load(), filepath.Join(absConfigDir, "missing"))
+}
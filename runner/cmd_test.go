@@ -3,6 +3,7 @@ package runner_test
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -203,3 +204,159 @@ func TestYamlSplit(t *testing.T) {
 		assert.Equal(t, tokens[2], name)
 	}
 }
+
+func TestManifestsChart(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fManifests")
+	require.NoError(t, err)
+
+	// a dry run spawns nothing, and manifests charts need no command
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", true, false, "", "")
+	tmpDir := t.TempDir()
+
+	require.NoError(t, c.Initialize(tmpDir))
+	require.NoError(t, runner.NewRunner(c).DoBuild(tmpDir, filepath.Join(tmpDir, "build")))
+
+	read := func(name string) string {
+		files, err := filepath.Glob(filepath.Join(tmpDir, "compiled-"+name+"-*.yaml"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		content, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+
+		return string(content)
+	}
+
+	app := read("app")
+	assert.Contains(t, app, "image: nginx:1.25")
+	assert.Contains(t, app, "kind: Service\n")
+	assert.Contains(t, app, "kind: ServiceAccount\n")
+	assert.NotContains(t, app, "wip")
+	assert.NotContains(t, app, "Hand-written")
+	// files are sorted by path
+	assert.Less(t, strings.Index(app, "kind: Deployment"), strings.Index(app, "kind: Service\n"))
+
+	assert.Contains(t, read("extra"), "namespace: manifests")
+
+	requireInvalid(t, "manifests",
+		`5:16: chart "app": namespace cannot be used on manifests charts`,
+		`3:5: chart "app": invalid pattern "[a-"`,
+		`10:14: chart "upstream": include cannot be used on kustomize charts`,
+	)
+}
+
+func TestKustomizeFolders(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fKustomizeLayers")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "env", true, false, "", "")
+	tmpDir := t.TempDir()
+
+	require.NoError(t, c.Initialize(tmpDir))
+	require.NoError(t, runner.NewRunner(c).DoBuild(tmpDir, filepath.Join(tmpDir, "build")))
+
+	read := func(path ...string) string {
+		content, err := os.ReadFile(filepath.Join(path...))
+		require.NoError(t, err)
+
+		return string(content)
+	}
+
+	// the layers are copied in the build directory, at the same place relative
+	// to each other, and their kustomize folders are hydrated there
+	base := filepath.Join(tmpDir, "kustomize", "base", "kustomize")
+	kustomization := read(base, "kustomization.yaml")
+	assert.Contains(t, kustomization, "- ../../..\n")
+	assert.Contains(t, kustomization, "team: otter\n")
+	assert.Equal(t, read(absConfigDir, "base", "kustomize", "patch.yaml"), read(base, "patch.yaml"))
+	assert.Equal(t,
+		read(absConfigDir, "base", "resources", "service.yaml"),
+		read(tmpDir, "kustomize", "base", "resources", "service.yaml"),
+	)
+	assert.Contains(t, read(tmpDir, "kustomize", "env", "kustomize", "kustomization.yaml"), "- ../../base/kustomize\n")
+
+	// the layers are left untouched
+	assert.Contains(t, read(absConfigDir, "base", "kustomize", "kustomization.yaml"), "<[beaver.build]>")
+	assert.NoFileExists(t, filepath.Join(absConfigDir, "base", "kustomize", "kustomization.yaml.back"))
+}
+
+func TestExecChart(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fExec")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", false, false, "", "")
+	tmpDir := t.TempDir()
+
+	require.NoError(t, c.Initialize(tmpDir))
+
+	chart := c.Spec.Charts["render"]
+	require.Len(t, chart.ValuesFileNames, 1)
+
+	args, err := chart.BuildArgs("render", c.Namespace)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./render.sh", "nginx:1.25"}, args)
+
+	engine, ok := runner.LookupEngine(runner.ExecType)
+	require.True(t, ok)
+
+	command, err := engine.Command(runner.ChartContext{
+		Key: "render", Chart: chart, Release: "my-release", Namespace: c.Namespace,
+	})
+	require.NoError(t, err)
+
+	stdout, _, err := runner.RunCMD(command)
+	require.NoError(t, err)
+
+	output := strings.Join(stdout, "\n")
+	assert.Contains(t, output, "name: my-release\n")
+	assert.Contains(t, output, "namespace: exec\n")
+	assert.Contains(t, output, "chart: render\n")
+	assert.Contains(t, output, "path: "+filepath.Join(absConfigDir, "base")+"\n")
+	assert.Contains(t, output, "image: nginx:1.25\n")
+	// the value files are hydrated
+	assert.Contains(t, output, "    image: nginx:1.25")
+}
+
+type fakeEngine struct{}
+
+func (fakeEngine) Validate(chart runner.Chart) []runner.ChartError {
+	if chart.Path == "" {
+		return []runner.ChartError{{Msg: "missing path"}}
+	}
+
+	return nil
+}
+
+func (fakeEngine) Command(runner.ChartContext) (*cmd.Cmd, error) {
+	return nil, nil //nolint:nilnil // rendered in-process
+}
+
+func (fakeEngine) Render(chart runner.ChartContext, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "kind: Fake\nmetadata:\n  name: %s\n  namespace: %s\n", chart.Release, chart.Namespace)
+
+	return err
+}
+
+func (fakeEngine) WatchedPaths(runner.CmdChart) []string {
+	return nil
+}
+
+func TestRegisterEngine(t *testing.T) {
+	runner.RegisterEngine("fake", fakeEngine{})
+
+	assert.Equal(t, []string{"helm", "ytt", "kustomize", "manifests", "exec", "fake"}, runner.ChartTypes())
+
+	// a registered engine is known to the validation
+	config := runner.Config{Charts: map[string]runner.Chart{"demo": {Type: "fake"}}}
+	require.EqualError(t, config.Validate(), `: chart "demo": missing path`)
+
+	config.Charts["demo"] = runner.Chart{Type: "fake", Path: "demo"}
+	require.NoError(t, config.Validate())
+
+	args, err := runner.CmdChart{Type: "fake"}.BuildArgs("demo", "ns")
+	require.EqualError(t, err, "fake chart demo is rendered by beaver, it has no command")
+	assert.Nil(t, args)
+}
@@ -1,9 +1,13 @@
 package runner
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,7 +25,8 @@ type Sha struct {
 
 // Chart define a chart to compile.
 type Chart struct {
-	// Type: chart type, can be either `ytt` or `helm`
+	// Type: chart type, can be `helm`, `ytt`, `kustomize`, `manifests`, `exec`
+	// or the type of an engine registered with RegisterEngine
 	Type string `yaml:"type"`
 	// Path: relative path to the chart itself
 	Path string `yaml:"path"`
@@ -33,14 +38,41 @@ type Chart struct {
 	// This can be useful when inheriting the chart
 	// must be castable to bool (0,1,true,false)
 	Disabled string `yaml:"disabled"`
+	// Include: glob patterns of the files of the path to render (manifests
+	// only), defaults to `*.yaml` and `*.yml`
+	Include []string `yaml:"include,flow"`
+	// Exclude: glob patterns of the files of the path to skip (manifests only)
+	Exclude []string `yaml:"exclude,flow"`
+	// Command: the command printing the resources of the chart (exec only),
+	// run in the directory of the config file
+	Command []string `yaml:"command,flow"`
+	// Set: values given to helm with `--set` (helm only)
+	Set map[string]string `yaml:"set"`
+	// SetString: values given to helm with `--set-string` (helm only)
+	SetString map[string]string `yaml:"setString"`
+	// KubeVersion: the kubernetes version of `.Capabilities` (helm only)
+	KubeVersion string `yaml:"kubeVersion"`
+	// APIVersions: the api versions of `.Capabilities` (helm only)
+	APIVersions []string `yaml:"apiVersions"`
+	// IncludeCrds: include the CRDs in the resources (helm only)
+	IncludeCrds bool `yaml:"includeCrds"`
+	// SkipTests: skip the tests of the chart (helm only)
+	SkipTests bool `yaml:"skipTests"`
+	// SkipCrds: skip the CRDs (helm only)
+	SkipCrds bool `yaml:"skipCrds"`
+	// PostRenderer: the post renderer given to helm, a path is relative to
+	// this file (helm only)
+	PostRenderer string `yaml:"postRenderer"`
+	// ExtraArgs: more arguments given to helm template (helm only)
+	ExtraArgs []string `yaml:"extraArgs"`
 }
 
 // Arg define command line arguments.
 type Arg struct {
 	// Flag: is a CLI flag, eg. `--from-file`
-	Flag string `yaml:"flag"`
+	Flag string `json:"flag" yaml:"flag"`
 	// Value: is the value for this flag, eg. `path/to/my/files`
-	Value string `yaml:"value"`
+	Value string `json:"value" yaml:"value"`
 }
 
 // Create define kubectl create command invocation.
@@ -53,6 +85,26 @@ type Create struct {
 	Args []Arg `yaml:"args,flow"`
 }
 
+// CreateRef identifies a kubectl create command.
+type CreateRef struct {
+	// Type: of the created resource, eg. configmap
+	Type string `yaml:"type"`
+	// Name: of the created resource
+	Name string `yaml:"name"`
+}
+
+// Remove lists the inherited entries a project removes.
+type Remove struct {
+	// Variables: variable names, a dotted name removes a part of a variable
+	Variables []string `yaml:"variables,flow"`
+	// Charts: chart names
+	Charts []string `yaml:"charts,flow"`
+	// Sha: sha keys
+	Sha []string `yaml:"sha,flow"`
+	// Creates: kubectl create commands
+	Creates []CreateRef `yaml:"create,flow"`
+}
+
 // Config represent the beaver.yaml config file.
 type Config struct {
 	// Inherit: relative path to another beaver project
@@ -64,8 +116,21 @@ type Config struct {
 	NameSpace string `yaml:"namespace"`
 	// Inherits: list of relative path to other beaver projects
 	Inherits []string `yaml:"inherits,flow"`
+	// VariablesFrom: yaml or json files of variables, relative to the
+	// project unless absolute, they are applied in order before the variables
+	// of the project
+	VariablesFrom []string `yaml:"variablesFrom,flow"`
+	// Env: environment variables the variables can use as `env.<NAME>`,
+	// no other environment variable is readable
+	Env map[string]EnvVar `yaml:"env"`
 	// Variables: list of beaver variables
 	Variables Variables `yaml:"variables,flow"`
+	// VariablesMerge, VariablesAppend, VariablesPrepend: variables merged
+	// into the inherited ones with the `deep`, `append` or `prepend` merge,
+	// they are applied after the variables block
+	VariablesMerge   Variables `yaml:"variables!merge,flow"`
+	VariablesAppend  Variables `yaml:"variables!append,flow"`
+	VariablesPrepend Variables `yaml:"variables!prepend,flow"`
 	// Sha: list of Sha
 	Sha []Sha `yaml:"sha,flow"`
 	// Charts: map of charts definitions, where the key is the chart name for beaver values.
@@ -73,31 +138,156 @@ type Config struct {
 	Charts map[string]Chart `yaml:"charts,flow"`
 	// Creates: list of kubectl create commands
 	Creates []Create `yaml:"create,flow"`
+	// Remove: inherited entries to remove, they are removed before the
+	// entries of this config are added
+	Remove Remove `yaml:"remove"`
 	// Dir: internal use
 	Dir string `yaml:"-"` // the directory in which we found the config file
+	// File: internal use
+	File string `yaml:"-"` // the path of the config file
+	// node: the decoded document, used to locate errors
+	node yaml.Node
+}
+
+// variableBlock is a variables section of a config file.
+type variableBlock struct {
+	// key: the yaml key of the section
+	key string
+	// merge: the merge of the variables of the section, empty for the
+	// variables block where each variable has its own
+	merge     string
+	variables Variables
+}
+
+// variableBlocks returns the variables sections of the config, in the order
+// they are applied.
+func (c *Config) variableBlocks() []variableBlock {
+	return []variableBlock{
+		{"variables", "", c.Variables},
+		{"variables!merge", MergeDeep, c.VariablesMerge},
+		{"variables!append", MergeAppend, c.VariablesAppend},
+		{"variables!prepend", MergePrepend, c.VariablesPrepend},
+	}
+}
+
+// LayerVariables returns the variables set by the config, in the order they
+// are applied, the variables of a merge block carry the merge of the block.
+func (c *Config) LayerVariables() Variables {
+	var variables Variables
+
+	for _, block := range c.variableBlocks() {
+		for _, variable := range block.variables {
+			if block.merge != "" {
+				variable.Merge = block.merge
+			}
+
+			variables = append(variables, variable)
+		}
+	}
+
+	return variables
 }
 
-// Absolutize makes all chart paths absolute.
-func (c *Config) Absolutize(dir string) error {
-	for name, chart := range c.Charts {
-		resolvedChartPath := filepath.Join(dir, chart.Path)
+// parentDirs returns the absolute dirs of the inherited projects, `inherits`
+// entries first and `inherit` last. The inherited paths are hydrated with the
+// own variables of the config, see ownVariables.
+func (c *Config) parentDirs(dir string, overrides Variables) ([]string, error) {
+	inherits := c.Inherits
+	if c.Inherit != "" {
+		inherits = append(inherits[:len(inherits):len(inherits)], c.Inherit)
+	}
+
+	parents := make([]string, 0, len(inherits))
+
+	var variables map[string]interface{}
+
+	for _, inherit := range inherits {
+		if strings.Contains(inherit, "<[") {
+			if variables == nil {
+				var err error
+				if variables, err = c.ownVariables(overrides); err != nil {
+					return nil, err
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := (HydrateOptions{Unescape: true}).HydrateString(inherit, &buf, variables); err != nil {
+				return nil, fmt.Errorf("cannot hydrate inherited project %s: %w", inherit, err)
+			}
+
+			inherit = buf.String()
+		}
+
+		resolvedDir := filepath.Join(dir, inherit)
 
-		absChartPath, err := filepath.Abs(resolvedChartPath)
+		parent, err := filepath.Abs(resolvedDir)
 		if err != nil {
-			return fmt.Errorf("failed to find abs() for %s: %w", resolvedChartPath, err)
+			return nil, fmt.Errorf("failed to find abs() for %s: %w", resolvedDir, err)
 		}
 
-		chart.Path = absChartPath
-		c.Charts[name] = chart
+		if contains(parents, parent) {
+			return nil, fmt.Errorf("%s inherits %s more than once", dir, parent)
+		}
+
+		parents = append(parents, parent)
+	}
+
+	return parents, nil
+}
+
+// ownVariables returns the variables of the config, without the inherited
+// ones nor the variablesFrom files, overlaid with the given overrides, along
+// with the `env.<NAME>` variables of its own env section.
+func (c *Config) ownVariables(overrides Variables) (map[string]interface{}, error) {
+	var merged Variables
+
+	for _, variable := range append(c.LayerVariables(), overrides...) {
+		variable.Value = CopyValue(variable.Value)
+		if err := merged.Overlay(variable); err != nil {
+			return nil, err
+		}
+	}
+
+	variables := make(map[string]interface{}, len(merged)+1)
+	for _, variable := range merged {
+		variables[variable.Name] = variable.Value
+	}
+
+	if len(c.Env) != 0 {
+		env := make(map[string]interface{}, len(c.Env))
+
+		for name, envVar := range c.Env {
+			if value, ok := os.LookupEnv(name); ok {
+				env[name] = value
+			} else if envVar.Default != nil {
+				env[name] = *envVar.Default
+			}
+		}
+
+		variables["env"] = env
 	}
 
-	return nil
+	return variables, nil
 }
 
 // NewConfig returns a *Config.
 func NewConfig(configDir string) (*Config, error) {
+	config, err := readConfig(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// readConfig finds and strictly decodes the beaver config file of a
+// directory, without any semantic check.
+func readConfig(configDir string) (*Config, error) {
 	configName := "beaver"
-	config := Config{}
 
 	for _, ext := range []string{"yaml", "yml"} {
 		configPath := filepath.Join(configDir, fmt.Sprintf("%s.%s", configName, ext))
@@ -112,9 +302,17 @@ func NewConfig(configDir string) (*Config, error) {
 			return nil, fmt.Errorf("fail to read config file: %s - %w", configPath, err)
 		}
 
-		err = yaml.Unmarshal(configFile, &config)
-		if err != nil {
-			return nil, fmt.Errorf("fail unmarshal config file: %s - %w", configPath, err)
+		config := Config{File: configPath}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(configFile))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, decodeError(configPath, err)
+		}
+
+		if err := yaml.Unmarshal(configFile, &config.node); err != nil {
+			return nil, decodeError(configPath, err)
 		}
 
 		return &config, nil
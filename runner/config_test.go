@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,7 @@ const (
 	disabledAsVar         = "fixtures/fDisabledAsVar"
 	namespaceAsVar        = "fixtures/fNamespaceAsVar"
 	versionTest           = "fixtures/versionTest"
+	invalidFixtures       = "fixtures/fInvalid"
 )
 
 func TestConfig(t *testing.T) {
@@ -50,6 +52,35 @@ func TestConfigVersionInValid(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestControlVersions(t *testing.T) {
+	for _, tt := range []struct {
+		desired string
+		actual  string
+		valid   bool
+	}{
+		{"3.2.3", "3.2.3", true},
+		{"3.2.3", "3.2.4", false},
+		{">= 3.2.6, < 4", "3.2.10", true},
+		{">= 3.2.6, < 4", "3.2.5", false},
+		{">= 3.2.6, < 4", "4.0.0", false},
+		{"~> 3.2", "3.9.1", true},
+		{"~> 3.2", "4.0.0", false},
+		{"~> 3.2.6", "3.2.10", true},
+		{"~> 3.2.6", "3.3.0", false},
+	} {
+		t.Run(tt.desired+"/"+tt.actual, func(t *testing.T) {
+			err := beaver.ControlVersions(tt.desired, tt.actual)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	require.Error(t, beaver.ControlVersions("not a version", "3.2.3"))
+}
+
 func TestBuildArgs(t *testing.T) {
 	config, err := runner.NewConfig(filepath.Join(helmNamespaceFixtures, "base"))
 	require.NoError(t, err)
@@ -67,6 +98,85 @@ func TestBuildArgs(t *testing.T) {
 	}
 }
 
+func TestKustomizeChart(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fKustomize")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	chart := c.Spec.Charts["upstream"]
+	assert.Equal(t, runner.KustomizeType, chart.Type)
+
+	args, err := chart.BuildArgs("upstream", "kustomize")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kustomize", filepath.Join(absConfigDir, "base", "upstream")}, args)
+
+	chart.ValuesFileNames = []string{"upstream.yaml"}
+	_, err = chart.BuildArgs("upstream", "kustomize")
+	require.EqualError(t, err, "kustomize chart upstream cannot have value files: upstream.yaml")
+
+	requireInvalid(t, "kustomize",
+		`5:11: chart "upstream": name cannot be used on kustomize charts`,
+		`6:16: chart "upstream": namespace cannot be used on kustomize charts`,
+	)
+}
+
+func TestHelmOptions(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/fHelmOptions")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", false, false, "", "")
+
+	require.NoError(t, c.Load())
+
+	base := filepath.Join(absConfigDir, "base")
+
+	args, err := c.Spec.Charts["postgres"].BuildArgs("postgres", "options")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"template", "postgres", filepath.Join(base, "postgresql"), "--namespace", "options",
+		"--set", "image.tag=16.2", "--set", "replicas=2",
+		"--set-string", "podLabels.build=0123",
+		"--kube-version", "v1.29.4",
+		"--api-versions", "monitoring.coreos.com/v1",
+		"--include-crds", "--skip-tests",
+		"--post-renderer", filepath.Join(base, "hooks", "post-render.sh"),
+		"--no-hooks",
+	}, args)
+
+	for _, tt := range []struct {
+		name  string
+		chart runner.Chart
+		err   string
+	}{
+		{
+			"ytt",
+			runner.Chart{Type: "ytt", Path: "demo", Set: map[string]string{"a": "b"}, SkipTests: true},
+			`: chart "demo": set cannot be used on ytt charts` + "\n" +
+				`: chart "demo": skipTests cannot be used on ytt charts`,
+		},
+		{
+			"crds",
+			runner.Chart{Type: "helm", Path: "demo", IncludeCrds: true, SkipCrds: true},
+			`: chart "demo": includeCrds and skipCrds cannot be used together`,
+		},
+		{
+			"empty-key",
+			runner.Chart{Type: "helm", Path: "demo", SetString: map[string]string{"": "b"}},
+			`: chart "demo": setString: empty key`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := runner.Config{Charts: map[string]runner.Chart{"demo": tt.chart}}
+			require.EqualError(t, config.Validate(), tt.err)
+		})
+	}
+}
+
 func TestHydrate(t *testing.T) {
 	rawVariables := []byte(`
 #@data/values
@@ -512,3 +622,55 @@ func parseFile(input string) (map[string]interface{}, error) {
 
 	return resource, nil
 }
+
+func TestConfigValidate(t *testing.T) {
+	absDir, err := filepath.Abs(invalidFixtures)
+	require.NoError(t, err)
+
+	semantic := filepath.Join(absDir, "semantic", "beaver.yml")
+
+	_, err = runner.NewConfig(filepath.Join(absDir, "semantic"))
+	require.Error(t, err)
+
+	for _, expected := range []string{
+		semantic + `:5:11: chart "demo": name cannot be used on ytt charts`,
+		semantic + `:8:11: chart "typo": unknown type "hlem", must be one of: ` + strings.Join(runner.ChartTypes(), ", ") + "\n",
+		semantic + ":11:3: sha #0: missing resource",
+		semantic + ":16:5: create configmap demo: arg #0 has no flag",
+	} {
+		assert.Contains(t, err.Error(), expected)
+	}
+
+	_, err = runner.NewConfig(filepath.Join(invalidFixtures, "unknown"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(invalidFixtures, "unknown", "beaver.yml")+`:2: unknown field "chart" in config`)
+
+	tl := testutils.NewTestLogger(t)
+	c := runner.NewCmdConfig(tl.Logger(), absDir, "env", false, false, "", "")
+
+	err = c.Validate()
+	require.Error(t, err)
+	// every layer is checked
+	assert.Contains(t, err.Error(), filepath.Join(absDir, "env", "beaver.yml")+`:6: unknown field "dissabled" in chart`)
+	assert.Contains(t, err.Error(), filepath.Join(absDir, "unknown", "beaver.yml")+`:2: unknown field "chart" in config`)
+	assert.Contains(t, err.Error(), semantic+":11:3: sha #0: missing resource")
+
+	c = runner.NewCmdConfig(tl.Logger(), absDir, "../f1/environments/ns1", false, false, "", "")
+	require.NoError(t, c.Validate())
+}
+
+// requireInvalid reads the config of fixtures/fInvalid/<name> and checks that
+// it is invalid with the expected errors, given as `<line>:<column>: <error>`.
+func requireInvalid(t *testing.T, name string, expected ...string) {
+	t.Helper()
+
+	dir, err := filepath.Abs(filepath.Join(invalidFixtures, name))
+	require.NoError(t, err)
+
+	_, err = runner.NewConfig(dir)
+	require.Error(t, err)
+
+	for _, e := range expected {
+		assert.Contains(t, err.Error(), filepath.Join(dir, "beaver.yml")+":"+e)
+	}
+}
@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// BuildDiff describes the differences between two build output directories.
+type BuildDiff struct {
+	// Added: resources only present in the new build
+	Added []string
+	// Removed: resources only present in the old build
+	Removed []string
+	// Modified: resources present in both builds with a different content
+	Modified []string
+	// Diffs: unified diff of each modified, added or removed resource
+	Diffs map[string]string
+}
+
+// HasChanges returns true if the two builds differ.
+func (d *BuildDiff) HasChanges() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Modified) > 0
+}
+
+// Summary returns a one line summary of the differences.
+func (d *BuildDiff) Summary() string {
+	return fmt.Sprintf("%d added, %d removed, %d modified", len(d.Added), len(d.Removed), len(d.Modified))
+}
+
+// String returns the per resource unified diff.
+func (d *BuildDiff) String() string {
+	var b strings.Builder
+
+	for _, group := range []struct {
+		prefix string
+		names  []string
+	}{
+		{"added", d.Added},
+		{"removed", d.Removed},
+		{"modified", d.Modified},
+	} {
+		for _, name := range group.names {
+			fmt.Fprintf(&b, "%s: %s\n", group.prefix, name)
+		}
+	}
+
+	names := make([]string, 0, len(d.Diffs))
+	for name := range d.Diffs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(d.Diffs[name])
+	}
+
+	return b.String()
+}
+
+// ReadResources returns the content of every resource file found in a build
+// output directory, keyed by file name. A missing directory is considered
+// empty.
+func ReadResources(dir string) (map[string]string, error) {
+	resources := make(map[string]string)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return resources, nil
+		}
+
+		return nil, fmt.Errorf("cannot list directory: %s - %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read resource: %w", err)
+		}
+
+		resources[entry.Name()] = string(content)
+	}
+
+	return resources, nil
+}
+
+// DiffDirs compares the resources of two build output directories.
+func DiffDirs(oldDir, newDir string) (*BuildDiff, error) {
+	oldResources, err := ReadResources(oldDir)
+	if err != nil {
+		return nil, err
+	}
+
+	newResources, err := ReadResources(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffResources(oldResources, newResources)
+}
+
+// DiffResources compares two sets of resources as returned by ReadResources.
+func DiffResources(oldResources, newResources map[string]string) (*BuildDiff, error) {
+	diff := BuildDiff{Diffs: make(map[string]string)}
+
+	names := make([]string, 0, len(oldResources)+len(newResources))
+
+	for name := range oldResources {
+		names = append(names, name)
+	}
+
+	for name := range newResources {
+		if _, ok := oldResources[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldContent, inOld := oldResources[name]
+		newContent, inNew := newResources[name]
+
+		switch {
+		case !inOld:
+			diff.Added = append(diff.Added, name)
+		case !inNew:
+			diff.Removed = append(diff.Removed, name)
+		case oldContent != newContent:
+			diff.Modified = append(diff.Modified, name)
+		default:
+			continue
+		}
+
+		fromFile, toFile := "a/"+name, "b/"+name
+		if !inOld {
+			fromFile = "/dev/null"
+		}
+
+		if !inNew {
+			toFile = "/dev/null"
+		}
+
+		unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(oldContent),
+			B:        difflib.SplitLines(newContent),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot diff resource %s: %w", name, err)
+		}
+
+		diff.Diffs[name] = unified
+	}
+
+	return &diff, nil
+}
@@ -0,0 +1,55 @@
+package runner_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+func TestDiffDirs(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+
+	writeFiles := func(dir string, files map[string]string) {
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+		}
+	}
+
+	writeFiles(oldDir, map[string]string{
+		"ConfigMap.v1.same.yaml":     "---\nkind: ConfigMap\n",
+		"ConfigMap.v1.changed.yaml":  "---\nkind: ConfigMap\ndata:\n  a: b\n",
+		"ConfigMap.v1.removed.yaml":  "---\nkind: ConfigMap\n",
+		"Deployment.apps_v1.db.yaml": "---\nkind: Deployment\n",
+	})
+	writeFiles(newDir, map[string]string{
+		"ConfigMap.v1.same.yaml":     "---\nkind: ConfigMap\n",
+		"ConfigMap.v1.changed.yaml":  "---\nkind: ConfigMap\ndata:\n  a: c\n",
+		"ConfigMap.v1.added.yaml":    "---\nkind: ConfigMap\n",
+		"Deployment.apps_v1.db.yaml": "---\nkind: Deployment\n",
+	})
+
+	diff, err := runner.DiffDirs(oldDir, newDir)
+	require.NoError(t, err)
+
+	assert.True(t, diff.HasChanges())
+	assert.Equal(t, []string{"ConfigMap.v1.added.yaml"}, diff.Added)
+	assert.Equal(t, []string{"ConfigMap.v1.removed.yaml"}, diff.Removed)
+	assert.Equal(t, []string{"ConfigMap.v1.changed.yaml"}, diff.Modified)
+	assert.Equal(t, "1 added, 1 removed, 1 modified", diff.Summary())
+	assert.Len(t, diff.Diffs, 3)
+	assert.Contains(t, diff.Diffs["ConfigMap.v1.changed.yaml"], "-  a: b\n+  a: c\n")
+
+	diff, err = runner.DiffDirs(oldDir, oldDir)
+	require.NoError(t, err)
+	assert.False(t, diff.HasChanges())
+
+	diff, err = runner.DiffDirs(filepath.Join(oldDir, "missing"), newDir)
+	require.NoError(t, err)
+	assert.Len(t, diff.Added, 4)
+}
@@ -0,0 +1,390 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-cmd/cmd"
+)
+
+// ExecType is the type of the charts rendered by an arbitrary local command.
+const ExecType = "exec"
+
+// Engine renders the charts of a type. helm, ytt, kustomize, manifests and
+// exec are built-in engines, others can be added with RegisterEngine.
+type Engine interface {
+	// Validate checks the definition of a chart in a config file.
+	Validate(chart Chart) []ChartError
+	// Command returns the command printing the resources of the chart on its
+	// stdout, or nil if the engine renders the chart itself with Render.
+	Command(chart ChartContext) (*cmd.Cmd, error)
+	// Render writes the resources of the chart, it is only called when
+	// Command returns nil.
+	Render(chart ChartContext, w io.Writer) error
+	// WatchedPaths returns the files and directories the chart depends on,
+	// besides its value files.
+	WatchedPaths(chart CmdChart) []string
+}
+
+// ChartError is an error found by an engine in the definition of a chart.
+type ChartError struct {
+	// Field: the yaml name of the chart field at fault, empty for the whole
+	// chart
+	Field string
+	Msg   string
+}
+
+// ChartContext is a chart to render.
+type ChartContext struct {
+	// Key: the name of the chart in the config
+	Key   string
+	Chart CmdChart
+	// Release: the chart name, or its key when it has none
+	Release string
+	// Namespace: the chart namespace, or the project one when it has none
+	Namespace string
+	// Hydrate: writes the given file hydrated with the beaver variables
+	Hydrate func(path string, w io.Writer) error
+}
+
+// newChartContext returns the context of the chart key, namespace is the
+// project one.
+func newChartContext(key string, chart CmdChart, namespace string) ChartContext {
+	release := chart.Name
+	if release == "" {
+		release = key
+	}
+
+	if chart.Namespace != "" {
+		namespace = chart.Namespace
+	}
+
+	return ChartContext{Key: key, Chart: chart, Release: release, Namespace: namespace}
+}
+
+var (
+	enginesMutex sync.RWMutex
+	engines      = make(map[string]Engine)
+	// engineTypes: the registered chart types, in registration order
+	engineTypes []string
+)
+
+func init() {
+	RegisterEngine(HelmType, helmEngine{})
+	RegisterEngine(YttType, yttEngine{})
+	RegisterEngine(KustomizeType, kustomizeEngine{})
+	RegisterEngine(ManifestsType, manifestsEngine{})
+	RegisterEngine(ExecType, execEngine{})
+}
+
+// RegisterEngine registers the engine rendering the charts of the given
+// type, it replaces the engine already registered for that type if any.
+func RegisterEngine(chartType string, engine Engine) {
+	enginesMutex.Lock()
+	defer enginesMutex.Unlock()
+
+	if _, ok := engines[chartType]; !ok {
+		engineTypes = append(engineTypes, chartType)
+	}
+
+	engines[chartType] = engine
+}
+
+// LookupEngine returns the engine rendering the charts of the given type.
+func LookupEngine(chartType string) (Engine, bool) {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+
+	engine, ok := engines[chartType]
+
+	return engine, ok
+}
+
+// ChartTypes returns the known chart types.
+func ChartTypes() []string {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+
+	return append([]string{}, engineTypes...)
+}
+
+// unsupportedFields reports the given fields of chart which are set, as they
+// cannot be used on charts of type chartType.
+func unsupportedFields(chart Chart, chartType string, fields ...string) []ChartError {
+	var errs []ChartError
+
+	value := reflect.ValueOf(chart)
+
+	for i := range value.NumField() {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+		if contains(fields, name) && !value.Field(i).IsZero() {
+			errs = append(errs, ChartError{
+				Field: name,
+				Msg:   fmt.Sprintf("%s cannot be used on %s charts", name, chartType),
+			})
+		}
+	}
+
+	return errs
+}
+
+// valuesFileArgs returns the `-f <file>` arguments of the value files of a
+// chart.
+func valuesFileArgs(chart CmdChart) []string {
+	args := make([]string, 0, 2*len(chart.ValuesFileNames))
+	for _, vFile := range chart.ValuesFileNames {
+		args = append(args, "-f", vFile)
+	}
+
+	return args
+}
+
+// noValuesFiles returns an error if a chart, whose engine has no use for
+// them, has value files.
+func noValuesFiles(chart ChartContext) error {
+	if len(chart.Chart.ValuesFileNames) != 0 {
+		return fmt.Errorf(
+			"%s chart %s cannot have value files: %s",
+			chart.Chart.Type, chart.Key, strings.Join(chart.Chart.ValuesFileNames, ", "),
+		)
+	}
+
+	return nil
+}
+
+// commandEngine implements Render for the engines which always return a
+// command.
+type commandEngine struct{}
+
+func (commandEngine) Render(chart ChartContext, _ io.Writer) error {
+	return fmt.Errorf("%s chart %s is rendered by a command", chart.Chart.Type, chart.Key)
+}
+
+func (commandEngine) WatchedPaths(chart CmdChart) []string {
+	return []string{chart.Path}
+}
+
+// helmFields are the fields of a chart only used by helm.
+var helmFields = []string{
+	"set", "setString", "kubeVersion", "apiVersions", "includeCrds", "skipTests", "skipCrds", "postRenderer",
+	"extraArgs",
+}
+
+// withHelmFields returns fields followed by helmFields.
+func withHelmFields(fields ...string) []string {
+	return append(fields, helmFields...)
+}
+
+type helmEngine struct{ commandEngine }
+
+func (helmEngine) Validate(chart Chart) []ChartError {
+	errs := unsupportedFields(chart, HelmType, "include", "exclude", "command")
+
+	if chart.IncludeCrds && chart.SkipCrds {
+		errs = append(errs, ChartError{Field: "skipCrds", Msg: "includeCrds and skipCrds cannot be used together"})
+	}
+
+	for _, field := range []struct {
+		name   string
+		values map[string]string
+	}{{"set", chart.Set}, {"setString", chart.SetString}} {
+		for key := range field.values {
+			if key == "" {
+				errs = append(errs, ChartError{Field: field.name, Msg: field.name + ": empty key"})
+			}
+		}
+	}
+
+	return errs
+}
+
+func (helmEngine) Command(chart ChartContext) (*cmd.Cmd, error) {
+	// helm template name vendor/helm/mychart/ --namespace ns1 -f base.values.yaml -f ns.yaml -f ns.values.yaml
+	args := []string{"template", chart.Release, chart.Chart.Path, "--namespace", chart.Namespace}
+	args = append(args, valuesFileArgs(chart.Chart)...)
+
+	return cmd.NewCmd(helmCmd, append(args, helmOptionArgs(chart.Chart)...)...), nil
+}
+
+func (helmEngine) WatchedPaths(chart CmdChart) []string {
+	paths := []string{chart.Path}
+
+	if postRenderer := helmPostRenderer(chart); postRenderer != "" && filepath.IsAbs(postRenderer) {
+		paths = append(paths, postRenderer)
+	}
+
+	return paths
+}
+
+// helmOptionArgs returns the helm template arguments of the helm options of a
+// chart, the values of `set` and `setString` are sorted by key.
+func helmOptionArgs(chart CmdChart) []string {
+	var args []string
+
+	for _, option := range []struct {
+		flag   string
+		values map[string]string
+	}{{"--set", chart.Set}, {"--set-string", chart.SetString}} {
+		keys := make([]string, 0, len(option.values))
+		for key := range option.values {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			args = append(args, option.flag, key+"="+option.values[key])
+		}
+	}
+
+	if chart.KubeVersion != "" {
+		args = append(args, "--kube-version", chart.KubeVersion)
+	}
+
+	for _, apiVersion := range chart.APIVersions {
+		args = append(args, "--api-versions", apiVersion)
+	}
+
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{{"--include-crds", chart.IncludeCrds}, {"--skip-tests", chart.SkipTests}, {"--skip-crds", chart.SkipCrds}} {
+		if flag.set {
+			args = append(args, flag.name)
+		}
+	}
+
+	if postRenderer := helmPostRenderer(chart); postRenderer != "" {
+		args = append(args, "--post-renderer", postRenderer)
+	}
+
+	return append(args, chart.ExtraArgs...)
+}
+
+// helmPostRenderer returns the post renderer of a chart, a path is made
+// absolute from the directory of the layer declaring the chart, while a name
+// is looked up in the PATH by helm.
+func helmPostRenderer(chart CmdChart) string {
+	postRenderer := chart.PostRenderer
+	if strings.ContainsRune(postRenderer, filepath.Separator) && !filepath.IsAbs(postRenderer) {
+		postRenderer = filepath.Join(chart.Dir, postRenderer)
+	}
+
+	return postRenderer
+}
+
+type yttEngine struct{ commandEngine }
+
+func (yttEngine) Validate(chart Chart) []ChartError {
+	return unsupportedFields(chart, YttType, withHelmFields("name", "include", "exclude", "command")...)
+}
+
+func (yttEngine) Command(chart ChartContext) (*cmd.Cmd, error) {
+	args := []string{"-f", chart.Chart.Path}
+
+	return cmd.NewCmd(yttCmd, append(args, valuesFileArgs(chart.Chart)...)...), nil
+}
+
+type kustomizeEngine struct{ commandEngine }
+
+func (kustomizeEngine) Validate(chart Chart) []ChartError {
+	return unsupportedFields(
+		chart, KustomizeType, withHelmFields("name", "namespace", "include", "exclude", "command")...,
+	)
+}
+
+func (kustomizeEngine) Command(chart ChartContext) (*cmd.Cmd, error) {
+	// kustomize only takes a directory, it has no value files
+	if err := noValuesFiles(chart); err != nil {
+		return nil, err
+	}
+
+	return cmd.NewCmd(kubectlCmd, "kustomize", chart.Chart.Path), nil
+}
+
+type manifestsEngine struct{}
+
+func (manifestsEngine) Validate(chart Chart) []ChartError {
+	errs := unsupportedFields(chart, ManifestsType, withHelmFields("name", "namespace", "command")...)
+
+	for _, pattern := range append(chart.Include[:len(chart.Include):len(chart.Include)], chart.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, ChartError{Msg: fmt.Sprintf("invalid pattern %q", pattern)})
+		}
+	}
+
+	return errs
+}
+
+func (manifestsEngine) Command(ChartContext) (*cmd.Cmd, error) {
+	return nil, nil //nolint:nilnil // manifests charts are rendered by beaver
+}
+
+func (manifestsEngine) Render(chart ChartContext, w io.Writer) error {
+	return renderManifests(chart, w)
+}
+
+func (manifestsEngine) WatchedPaths(chart CmdChart) []string {
+	return []string{chart.Path}
+}
+
+// execEngine runs the command of the chart, see execEnv for its contract.
+type execEngine struct{ commandEngine }
+
+func (execEngine) Validate(chart Chart) []ChartError {
+	errs := unsupportedFields(chart, ExecType, withHelmFields("include", "exclude")...)
+
+	if len(chart.Command) == 0 || chart.Command[0] == "" {
+		errs = append(errs, ChartError{Msg: "missing command"})
+	}
+
+	return errs
+}
+
+func (execEngine) Command(chart ChartContext) (*cmd.Cmd, error) {
+	if len(chart.Chart.Command) == 0 {
+		return nil, fmt.Errorf("exec chart %s has no command", chart.Key)
+	}
+
+	c := cmd.NewCmd(chart.Chart.Command[0], chart.Chart.Command[1:]...)
+	c.Dir = chart.Chart.Dir
+	c.Env = append(os.Environ(), execEnv(chart)...)
+
+	return c, nil
+}
+
+func (e execEngine) WatchedPaths(chart CmdChart) []string {
+	paths := e.commandEngine.WatchedPaths(chart)
+
+	// a local script, rather than a command found in the PATH
+	if len(chart.Command) != 0 && strings.ContainsRune(chart.Command[0], filepath.Separator) {
+		script := chart.Command[0]
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(chart.Dir, script)
+		}
+
+		paths = append(paths, script)
+	}
+
+	return paths
+}
+
+// execEnv returns the environment variables given to the command of an exec
+// chart, on top of the beaver ones. The command runs in the directory of the
+// layer declaring the chart, and prints the resources on its stdout.
+func execEnv(chart ChartContext) []string {
+	return []string{
+		"BEAVER_CHART=" + chart.Key,
+		"BEAVER_CHART_PATH=" + chart.Chart.Path,
+		"BEAVER_RELEASE=" + chart.Release,
+		"BEAVER_NAMESPACE=" + chart.Namespace,
+		"BEAVER_VALUES_FILES=" + strings.Join(chart.Chart.ValuesFileNames, string(os.PathListSeparator)),
+	}
+}
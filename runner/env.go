@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	// EnvFromEnvironment is an environment variable read from the process
+	// environment.
+	EnvFromEnvironment = "environment"
+	// EnvFromDefault is an environment variable which is not set, replaced
+	// by its default value.
+	EnvFromDefault = "default"
+	// EnvUnset is an environment variable which is not set and has no
+	// default value.
+	EnvUnset = "unset"
+)
+
+// EnvVar declares an environment variable, which can then be used in the
+// beaver variables as `env.<NAME>`.
+type EnvVar struct {
+	// Default: value used when the environment variable is not set
+	Default *string `yaml:"default"`
+	// Required: fail if the environment variable is not set and has no
+	// default value
+	Required bool `yaml:"required"`
+}
+
+// EnvRead records an environment variable read by a build.
+type EnvRead struct {
+	Name string `json:"name" yaml:"name"`
+	// Source: one of EnvFromEnvironment, EnvFromDefault or EnvUnset
+	Source string `json:"source" yaml:"source"`
+}
+
+// readEnv reads the environment variables declared by the layers, they are
+// the only ones the variables can use.
+func (c *CmdConfig) readEnv() error {
+	if len(c.Spec.Env) == 0 {
+		return nil
+	}
+
+	if _, ok := c.Spec.Variables.Get("env"); ok {
+		return fmt.Errorf("variable env conflicts with the env section, which defines env.<NAME> variables")
+	}
+
+	names := make([]string, 0, len(c.Spec.Env))
+	for name := range c.Spec.Env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	c.Spec.EnvValues = make(map[string]interface{}, len(names))
+	c.Spec.EnvReads = make([]EnvRead, 0, len(names))
+
+	for _, name := range names {
+		envVar := c.Spec.Env[name]
+		read := EnvRead{Name: name}
+
+		value, ok := os.LookupEnv(name)
+
+		switch {
+		case ok:
+			read.Source = EnvFromEnvironment
+			c.Spec.EnvValues[name] = value
+		case envVar.Default != nil:
+			read.Source = EnvFromDefault
+			c.Spec.EnvValues[name] = *envVar.Default
+		case envVar.Required:
+			return fmt.Errorf("environment variable %s is required", name)
+		default:
+			read.Source = EnvUnset
+		}
+
+		c.Spec.EnvReads = append(c.Spec.EnvReads, read)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var slugInvalidCharsRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// tagFilterSpec describes a filter of the tag pipelines.
+type tagFilterSpec struct {
+	minArgs int
+	maxArgs int
+	// apply: transforms a value, nil for the filters handling missing
+	// variables, which are implemented by tagExpression.apply
+	apply func(value interface{}, args []interface{}) (interface{}, error)
+}
+
+func (s tagFilterSpec) arity() string {
+	switch {
+	case s.minArgs == s.maxArgs && s.maxArgs == 1:
+		return "1 argument"
+	case s.minArgs == s.maxArgs:
+		return fmt.Sprintf("%d arguments", s.maxArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", s.minArgs, s.maxArgs)
+	}
+}
+
+// tagFilters are the built-in filters, see the README for their description.
+var tagFilters = map[string]tagFilterSpec{
+	"default":  {minArgs: 1, maxArgs: 1},
+	"required": {minArgs: 0, maxArgs: 1},
+	"b64enc": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return base64.StdEncoding.EncodeToString([]byte(s)), nil
+	})},
+	"b64dec": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(decoded), nil
+	})},
+	"quote": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return strconv.Quote(s), nil
+	})},
+	"squote": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+	})},
+	"toJson": {apply: func(value interface{}, _ []interface{}) (interface{}, error) {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(b), nil
+	}},
+	"upper": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return strings.ToUpper(s), nil
+	})},
+	"lower": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return strings.ToLower(s), nil
+	})},
+	"trim": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return strings.TrimSpace(s), nil
+	})},
+	"slug": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		return strings.Trim(slugInvalidCharsRe.ReplaceAllString(strings.ToLower(s), "-"), "-"), nil
+	})},
+	"trunc": {minArgs: 1, maxArgs: 1, apply: stringFilter(func(s string, args []interface{}) (interface{}, error) {
+		length, ok := args[0].(int)
+		if !ok || length < 0 {
+			return nil, fmt.Errorf("expects a positive integer, got %v", args[0])
+		}
+
+		if runes := []rune(s); len(runes) > length {
+			return string(runes[:length]), nil
+		}
+
+		return s, nil
+	})},
+	"sha256": {apply: stringFilter(func(s string, _ []interface{}) (interface{}, error) {
+		sum := sha256.Sum256([]byte(s))
+
+		return hex.EncodeToString(sum[:]), nil
+	})},
+	"replace": {minArgs: 2, maxArgs: 2, apply: stringFilter(func(s string, args []interface{}) (interface{}, error) {
+		return strings.ReplaceAll(s, fmt.Sprint(args[0]), fmt.Sprint(args[1])), nil
+	})},
+}
+
+// stringFilter wraps a filter working on the string form of scalar values.
+func stringFilter(
+	apply func(s string, args []interface{}) (interface{}, error),
+) func(value interface{}, args []interface{}) (interface{}, error) {
+	return func(value interface{}, args []interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return apply(v, args)
+		case nil:
+			return apply("", args)
+		case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+			return nil, fmt.Errorf("expects a scalar value, got %T", value)
+		default:
+			return apply(fmt.Sprint(v), args)
+		}
+	}
+}
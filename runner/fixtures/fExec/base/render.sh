@@ -0,0 +1,15 @@
+#!/bin/sh
+# prints a configmap describing what beaver gives to the command
+cat <<YAML
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: $BEAVER_RELEASE
+  namespace: $BEAVER_NAMESPACE
+data:
+  chart: $BEAVER_CHART
+  path: $BEAVER_CHART_PATH
+  image: $1
+  values: |
+$(sed 's/^/    /' "$BEAVER_VALUES_FILES")
+YAML
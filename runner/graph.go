@@ -0,0 +1,331 @@
+package runner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InheritanceGraph is the inheritance graph of one or more beaver projects.
+type InheritanceGraph struct {
+	// Layers: every project found while resolving the inheritance, sorted
+	// by dir
+	Layers []GraphLayer
+	// Edges: an edge goes from a project to a project it inherits
+	Edges []GraphEdge
+}
+
+// GraphLayer is a project of an InheritanceGraph.
+type GraphLayer struct {
+	Dir string
+	// Root: the project was given to build the graph
+	Root bool
+	// Charts: the charts declared by the project
+	Charts []string
+	// Disabled: the charts disabled by the project
+	Disabled []string
+	// Conditional: the charts whose disabled flag depends on variables, with
+	// the flag, eg. `demo (<[disable_demo]>)`
+	Conditional []string
+	// Overrides: the variables of the project already set by a project it
+	// inherits
+	Overrides []string
+}
+
+// GraphEdge is an inheritance link of an InheritanceGraph.
+type GraphEdge struct {
+	From string
+	To   string
+	// Priority: position of To in the parents of From, starting at 1, the
+	// first parent wins
+	Priority int
+}
+
+// NewInheritanceGraph resolves the inheritance of the projects found in the
+// given absolute dirs.
+func NewInheritanceGraph(dirs []string) (*InheritanceGraph, error) {
+	graph := newLayerGraph(NewConfig, nil)
+
+	for _, dir := range dirs {
+		if _, err := graph.linearize(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	result := InheritanceGraph{}
+
+	for dir, node := range graph.nodes {
+		layer := GraphLayer{Dir: dir, Root: contains(dirs, dir)}
+
+		for name, chart := range node.config.Charts {
+			// the flag is only known once the variables are resolved
+			if strings.Contains(chart.Disabled, "<[") {
+				layer.Conditional = append(layer.Conditional, fmt.Sprintf("%s (%s)", name, chart.Disabled))
+
+				continue
+			}
+
+			disabled, err := ToBool(chart.Disabled)
+			if err != nil {
+				return nil, fmt.Errorf("%s: chart %s: %w", dir, name, err)
+			}
+
+			if disabled {
+				layer.Disabled = append(layer.Disabled, name)
+			} else {
+				layer.Charts = append(layer.Charts, name)
+			}
+		}
+
+		// variables set by the inherited projects
+		var inherited []string
+
+		for _, ancestor := range graph.linear[dir][1:] {
+			for _, variable := range graph.nodes[ancestor].config.LayerVariables() {
+				inherited = append(inherited, variable.Name)
+			}
+		}
+
+		for _, variable := range node.config.LayerVariables() {
+			name := variable.Name
+			if overrides(name, inherited) && !contains(layer.Overrides, name) {
+				layer.Overrides = append(layer.Overrides, name)
+			}
+		}
+
+		sort.Strings(layer.Charts)
+		sort.Strings(layer.Disabled)
+		sort.Strings(layer.Conditional)
+		sort.Strings(layer.Overrides)
+
+		result.Layers = append(result.Layers, layer)
+
+		for i, parent := range node.parents {
+			result.Edges = append(result.Edges, GraphEdge{From: dir, To: parent, Priority: i + 1})
+		}
+	}
+
+	result.sort()
+
+	return &result, nil
+}
+
+// overrides returns true if setting the variable name changes one of the
+// inherited variables.
+func overrides(name string, inherited []string) bool {
+	for _, other := range inherited {
+		if name == other || strings.HasPrefix(name, other+".") || strings.HasPrefix(other, name+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *InheritanceGraph) sort() {
+	sort.Slice(g.Layers, func(i, j int) bool {
+		return g.Layers[i].Dir < g.Layers[j].Dir
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+
+		return g.Edges[i].Priority < g.Edges[j].Priority
+	})
+}
+
+// Dependents returns the part of the graph made of the given projects and
+// of the projects which inherit them, directly or not.
+func (g *InheritanceGraph) Dependents(bases []string) (*InheritanceGraph, error) {
+	parents := make(map[string][]string)
+	for _, edge := range g.Edges {
+		parents[edge.From] = append(parents[edge.From], edge.To)
+	}
+
+	known := make(map[string]bool)
+	for _, layer := range g.Layers {
+		known[layer.Dir] = true
+	}
+
+	for _, base := range bases {
+		if !known[base] {
+			return nil, fmt.Errorf("%s is not inherited by any of the projects found", base)
+		}
+	}
+
+	// a project is kept if one of the bases is reachable from it
+	kept := make(map[string]bool)
+
+	var reaches func(dir string, seen map[string]bool) bool
+
+	reaches = func(dir string, seen map[string]bool) bool {
+		if contains(bases, dir) {
+			return true
+		}
+
+		seen[dir] = true
+
+		for _, parent := range parents[dir] {
+			if !seen[parent] && reaches(parent, seen) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, layer := range g.Layers {
+		if reaches(layer.Dir, make(map[string]bool)) {
+			kept[layer.Dir] = true
+		}
+	}
+
+	result := InheritanceGraph{}
+
+	for _, layer := range g.Layers {
+		if kept[layer.Dir] {
+			layer.Root = contains(bases, layer.Dir)
+			result.Layers = append(result.Layers, layer)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		if kept[edge.From] && kept[edge.To] {
+			result.Edges = append(result.Edges, edge)
+		}
+	}
+
+	return &result, nil
+}
+
+// FindProjects returns the dirs of the beaver projects found under root,
+// hidden directories are skipped.
+func FindProjects(root string) ([]string, error) {
+	var dirs []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		for _, ext := range []string{"yaml", "yml"} {
+			if _, err := os.Stat(filepath.Join(path, "beaver."+ext)); err == nil {
+				dirs = append(dirs, path)
+
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find beaver projects in %s: %w", root, err)
+	}
+
+	return dirs, nil
+}
+
+// DOT returns the graph in the graphviz DOT language, the project dirs are
+// displayed relative to root.
+func (g *InheritanceGraph) DOT(root string) string {
+	var b strings.Builder
+
+	b.WriteString("digraph beaver {\n")
+	b.WriteString("  rankdir=BT;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	for _, layer := range g.Layers {
+		lines := append([]string{relDir(root, layer.Dir)}, layer.annotations()...)
+		for i, line := range lines {
+			lines[i] = strings.ReplaceAll(strings.ReplaceAll(line, `\`, `\\`), `"`, `\"`)
+		}
+
+		style := ""
+		if layer.Root {
+			style = ", style=bold"
+		}
+
+		fmt.Fprintf(&b, "  %q [label=\"%s\\l\"%s];\n", layer.Dir, strings.Join(lines, `\l`), style)
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=\"%d\"];\n", edge.From, edge.To, edge.Priority)
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid returns the graph as a mermaid flowchart, the project dirs are
+// displayed relative to root.
+func (g *InheritanceGraph) Mermaid(root string) string {
+	var b strings.Builder
+
+	b.WriteString("flowchart BT\n")
+
+	ids := make(map[string]string, len(g.Layers))
+
+	for i, layer := range g.Layers {
+		ids[layer.Dir] = fmt.Sprintf("layer%d", i)
+
+		lines := append([]string{relDir(root, layer.Dir)}, layer.annotations()...)
+		for i, line := range lines {
+			lines[i] = strings.ReplaceAll(line, `"`, "#quot;")
+		}
+
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[layer.Dir], strings.Join(lines, "<br/>"))
+
+		if layer.Root {
+			fmt.Fprintf(&b, "  style %s stroke-width:3px\n", ids[layer.Dir])
+		}
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -->|%d| %s\n", ids[edge.From], edge.Priority, ids[edge.To])
+	}
+
+	return b.String()
+}
+
+// annotations returns the lines describing what a layer changes.
+func (l GraphLayer) annotations() []string {
+	var lines []string
+
+	for _, annotation := range []struct {
+		title string
+		names []string
+	}{
+		{"charts", l.Charts},
+		{"disables", l.Disabled},
+		{"conditional", l.Conditional},
+		{"overrides", l.Overrides},
+	} {
+		if len(annotation.names) != 0 {
+			lines = append(lines, annotation.title+": "+strings.Join(annotation.names, ", "))
+		}
+	}
+
+	return lines
+}
+
+// relDir returns dir relative to root when possible.
+func relDir(root, dir string) string {
+	if rel, err := filepath.Rel(root, dir); err == nil {
+		return rel
+	}
+
+	return dir
+}
@@ -0,0 +1,101 @@
+package runner_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+func TestInheritanceGraph(t *testing.T) {
+	root, err := filepath.Abs("fixtures/fInheritDiamond")
+	require.NoError(t, err)
+
+	dir := func(name string) string {
+		return filepath.Join(root, name)
+	}
+
+	graph, err := runner.NewInheritanceGraph([]string{dir("env")})
+	require.NoError(t, err)
+
+	assert.Equal(t, []runner.GraphLayer{
+		{Dir: dir("a"), Overrides: []string{"who"}},
+		{Dir: dir("b"), Overrides: []string{"who"}},
+		{Dir: dir("base"), Charts: []string{"demo"}},
+		{Dir: dir("env"), Root: true},
+	}, graph.Layers)
+	assert.Equal(t, []runner.GraphEdge{
+		{From: dir("a"), To: dir("base"), Priority: 1},
+		{From: dir("b"), To: dir("base"), Priority: 1},
+		{From: dir("env"), To: dir("a"), Priority: 1},
+		{From: dir("env"), To: dir("b"), Priority: 2},
+	}, graph.Edges)
+
+	assert.Contains(t, graph.DOT(root), `"`+dir("env")+`" -> "`+dir("b")+`" [label="2"];`)
+	assert.Contains(t, graph.Mermaid(root), `layer2["base<br/>charts: demo"]`)
+
+	dependents, err := graph.Dependents([]string{dir("b")})
+	require.NoError(t, err)
+
+	assert.Equal(t, []runner.GraphLayer{
+		{Dir: dir("b"), Root: true, Overrides: []string{"who"}},
+		{Dir: dir("env")},
+	}, dependents.Layers)
+	assert.Equal(t, []runner.GraphEdge{
+		{From: dir("env"), To: dir("b"), Priority: 2},
+	}, dependents.Edges)
+
+	_, err = graph.Dependents([]string{dir("unknown")})
+	require.Error(t, err)
+}
+
+func TestInheritanceGraphDisabled(t *testing.T) {
+	root, err := filepath.Abs("fixtures/fGraphDisabled")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		expected runner.GraphLayer
+		note     string
+	}{
+		{
+			"enabled",
+			runner.GraphLayer{Dir: filepath.Join(root, "enabled"), Root: true, Charts: []string{"demo", "other"}},
+			`charts: demo, other`,
+		},
+		{
+			"conditional",
+			runner.GraphLayer{
+				Dir:         filepath.Join(root, "conditional"),
+				Root:        true,
+				Disabled:    []string{"other"},
+				Conditional: []string{"demo (<[disable_demo]>)"},
+			},
+			`disables: other<br/>conditional: demo (<[disable_demo]>)`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := runner.NewInheritanceGraph([]string{tt.expected.Dir})
+			require.NoError(t, err)
+			require.Len(t, graph.Layers, 2)
+
+			assert.Equal(t, tt.expected, graph.Layers[1])
+			assert.Contains(t, graph.Mermaid(root), tt.note)
+		})
+	}
+}
+
+func TestFindProjects(t *testing.T) {
+	projects, err := runner.FindProjects("fixtures/fInheritDiamond")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"fixtures/fInheritDiamond/a",
+		"fixtures/fInheritDiamond/b",
+		"fixtures/fInheritDiamond/base",
+		"fixtures/fInheritDiamond/env",
+	}, projects)
+}
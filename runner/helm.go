@@ -28,7 +28,10 @@ func (c *CmdConfig) HelmDependencyBuild() error {
 	c.Logger.Debug().Strs("paths", paths).Msg("found helm dependencies")
 
 	for _, p := range paths {
-		if err := c.HelmBuildDependency(p); err != nil {
+		err := c.Cache.helmDependencyBuild(p, func() error {
+			return c.HelmBuildDependency(p)
+		})
+		if err != nil {
 			return err
 		}
 	}
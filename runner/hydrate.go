@@ -7,54 +7,62 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 
-	"github.com/valyala/fasttemplate"
 	"gopkg.in/yaml.v3"
 )
 
-// ^<\[ starts with literal <[
-// ([^<\[\]>]*) a capturing group that matches any 0 or more (due to the * quantifier)
-// characters other than <, [ and ],>
-// ([^...] is a negated character class matching any char but the one(s) specified between [^ and ])
-// \]>$ ends with literal ]>.
-var beaverVariableRe = regexp.MustCompile(`^<\[([^<\[\]>]*)\]>$`)
+// escapedTag is the escape sequence of a literal `<[`.
+const escapedTag = `\<[`
+
+// escapedTagPlaceholder replaces the escaped tags while expanding the
+// variables, so that they are not taken as tags.
+const escapedTagPlaceholder = "\uE000beaver-escaped-tag\uE000"
+
+// DefaultHydrateMaxDepth is the default maximum depth of nested variable
+// references.
+const DefaultHydrateMaxDepth = 16
+
+// noHydrateMarker disables the hydration of a file when found in its leading
+// comments.
+const noHydrateMarker = "# beaver: no-hydrate"
+
+// HydrateOptions tunes the hydration of beaver variables.
+type HydrateOptions struct {
+	// Unescape turns the escaped tags (`\<[`) into literal `<[`. It must only
+	// be set for the last hydration of a build, the earlier ones keep the
+	// escape sequences so that the following ones do not expand them.
+	Unescape bool
+	// MaxDepth is the maximum depth of nested variable references, it
+	// defaults to DefaultHydrateMaxDepth.
+	MaxDepth int
+}
 
-// HydrateString will replace all instance of beaver variables in a given string.
-func HydrateString(input string, output io.Writer, variables map[string]interface{}) error {
-	t, err := fasttemplate.NewTemplate(input, "<[", "]>")
-	if err != nil {
-		return fmt.Errorf("unexpected error when parsing template: %w", err)
+func (o HydrateOptions) expansion(variables map[string]interface{}) *expansion {
+	maxDepth := o.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultHydrateMaxDepth
 	}
 
-	s, err := t.ExecuteFuncStringWithErr(func(w io.Writer, tag string) (int, error) {
-		val, ok := LookupVariable(variables, tag)
-		if !ok {
-			return 0, fmt.Errorf("tag not found: %s", tag)
-		}
+	return &expansion{variables: variables, maxDepth: maxDepth}
+}
 
-		switch v := val.(type) {
-		case string:
-			return w.Write([]byte(strings.TrimSuffix(v, "\n")))
-		case int:
-			return w.Write([]byte(strings.TrimSuffix(strconv.Itoa(v), "\n")))
-		default:
-			e := yaml.NewEncoder(w)
-			err := e.Encode(val)
+// HydrateString will replace all instance of beaver variables in a given string.
+func HydrateString(input string, output io.Writer, variables map[string]interface{}) error {
+	return HydrateOptions{}.HydrateString(input, output, variables)
+}
 
-			return 0, err
-		}
-	})
+// HydrateString will replace all instance of beaver variables in a given string.
+func (o HydrateOptions) HydrateString(input string, output io.Writer, variables map[string]interface{}) error {
+	s, err := o.expansion(variables).expandString(input, nil)
 	if err != nil {
 		return err
 	}
 
-	// Search for over occurrences of beaver variables
-	regex := regexp.MustCompile(`<\[([^<\[\]>]*)\]>`)
-	for regex.MatchString(s) {
-		return HydrateString(s, output, variables)
+	if o.Unescape {
+		s = strings.ReplaceAll(s, escapedTagPlaceholder, "<[")
+	} else {
+		s = strings.ReplaceAll(s, escapedTagPlaceholder, escapedTag)
 	}
 
 	if _, err := output.Write([]byte(s)); err != nil {
@@ -66,20 +74,21 @@ func HydrateString(input string, output io.Writer, variables map[string]interfac
 
 // HydrateScalarNode a yaml node.
 func HydrateScalarNode(node *yaml.Node, variables map[string]interface{}) error {
-	input := node.Value
-
-	// find all matches
-	matches := beaverVariableRe.FindAllStringSubmatch(input, -1)
+	return HydrateOptions{}.HydrateScalarNode(node, variables)
+}
 
-	if len(matches) == 1 {
-		// first match, then first extracted data (in position 1)
-		tag := matches[0][1]
+// HydrateScalarNode a yaml node.
+func (o HydrateOptions) HydrateScalarNode(node *yaml.Node, variables map[string]interface{}) error {
+	input := node.Value
 
-		var ok bool
+	if tag, ok := singleTag(input); ok {
+		output, err := o.expansion(variables).lookup(tag, nil)
+		if err != nil {
+			return err
+		}
 
-		output, ok := LookupVariable(variables, tag)
-		if !ok {
-			return fmt.Errorf("tag not found: %s", tag)
+		if str, ok := output.(string); ok && o.Unescape {
+			output = strings.ReplaceAll(str, escapedTag, "<[")
 		}
 
 		// preserve comments
@@ -96,7 +105,7 @@ func HydrateScalarNode(node *yaml.Node, variables map[string]interface{}) error
 		node.FootComment = fc
 	} else {
 		buf := bytes.NewBufferString("")
-		if err := HydrateString(input, buf, variables); err != nil {
+		if err := o.HydrateString(input, buf, variables); err != nil {
 			return err
 		}
 
@@ -107,16 +116,16 @@ func HydrateScalarNode(node *yaml.Node, variables map[string]interface{}) error
 }
 
 // hydrateYamlNodes ...
-func hydrateYamlNodes(nodes []*yaml.Node, variables map[string]interface{}) error {
+func (o HydrateOptions) hydrateYamlNodes(nodes []*yaml.Node, variables map[string]interface{}) error {
 	for _, node := range nodes {
 		if node.Kind == yaml.ScalarNode {
-			if err := HydrateScalarNode(node, variables); err != nil {
+			if err := o.HydrateScalarNode(node, variables); err != nil {
 				fmt.Printf("node: %+v, variables: %+v\n", node, variables)
 
 				return fmt.Errorf("failed to parse scalar: %w", err)
 			}
 		} else {
-			if err := hydrateYamlNodes(node.Content, variables); err != nil {
+			if err := o.hydrateYamlNodes(node.Content, variables); err != nil {
 				return fmt.Errorf("failed to hydrate content: %w", err)
 			}
 		}
@@ -125,15 +134,50 @@ func hydrateYamlNodes(nodes []*yaml.Node, variables map[string]interface{}) erro
 	return nil
 }
 
-// hydrateYaml hydrate a yaml document.
-func hydrateYaml(root *yaml.Node, variables map[string]interface{}) error {
-	err := hydrateYamlNodes(root.Content, variables)
+// Hydrate []byte.
+func Hydrate(input []byte, output io.Writer, variables map[string]interface{}) error {
+	return HydrateOptions{}.Hydrate(input, output, variables)
+}
+
+// Hydrate []byte.
+func (o HydrateOptions) Hydrate(input []byte, output io.Writer, variables map[string]interface{}) error {
+	return forEachDocument(
+		input,
+		output,
+		func(node *yaml.Node) error {
+			// FIXME: do not call this method when hydrating only for sha,
+			// could be quite expensive
+			if err := o.hydrateYamlNodes(node.Content, variables); err != nil {
+				return fmt.Errorf("failed to hydrate yaml: %w", err)
+			}
+
+			return nil
+		},
+		func(template string, output io.Writer) error {
+			return o.HydrateString(template, output, variables)
+		},
+	)
+}
+
+// escapeTags replaces every `<[` of the input by escapedTagPlaceholder, which
+// the last hydration turns back into `<[`. Unlike `\<[`, the placeholder is
+// valid anywhere in a yaml file, even in a double-quoted string, so the rest of
+// the input is copied verbatim.
+func escapeTags(input []byte, output io.Writer) error {
+	_, err := output.Write(bytes.ReplaceAll(input, []byte("<["), []byte(escapedTagPlaceholder)))
 
 	return err
 }
 
-// Hydrate []byte.
-func Hydrate(input []byte, output io.Writer, variables map[string]interface{}) error {
+// forEachDocument applies yamlFunc to each yaml document of the input, and
+// writes the result to the output. The documents which are not yaml are
+// given to rawFunc, which writes them itself.
+func forEachDocument(
+	input []byte,
+	output io.Writer,
+	yamlFunc func(node *yaml.Node) error,
+	rawFunc func(template string, output io.Writer) error,
+) error {
 	// documents := bytes.Split(input, []byte("---\n"))
 	documents := documentSplitter(bytes.NewReader(input))
 	// yaml lib ignore leading '---'
@@ -145,17 +189,12 @@ func Hydrate(input []byte, output io.Writer, variables map[string]interface{}) e
 		if err := yaml.Unmarshal(doc, &node); err != nil || len(node.Content) == 0 {
 			// not a yaml template, fallback to raw template method
 			// ...maybe a ytt header or a frontmatter
-			template := string(doc)
-			if err := HydrateString(template, output, variables); err != nil {
+			if err := rawFunc(string(doc), output); err != nil {
 				return err
 			}
 		} else {
-			// FIXME: do not call this method when hydrating only for sha,
-			// could be quite expensive
-			// yaml template method
-			err := hydrateYaml(&node, variables)
-			if err != nil {
-				return fmt.Errorf("failed to hydrate yaml: %w", err)
+			if err := yamlFunc(&node); err != nil {
+				return err
 			}
 
 			o, err := yaml.Marshal(node.Content[0])
@@ -180,24 +219,54 @@ func Hydrate(input []byte, output io.Writer, variables map[string]interface{}) e
 	return nil
 }
 
+// noHydrate returns true if the leading comments of a file contain the
+// noHydrateMarker.
+func noHydrate(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == noHydrateMarker:
+			return true
+		case line != "" && !strings.HasPrefix(line, "#"):
+			return false
+		}
+	}
+
+	return false
+}
+
 // hydrate a given file.
-func hydrate(input string, output io.Writer, variables map[string]interface{}, disabled bool) error {
+func (o HydrateOptions) hydrate(input string, output io.Writer, variables map[string]interface{}, disabled bool) error {
 	byteTemplate, err := os.ReadFile(input)
 	if err != nil {
 		return fmt.Errorf("failed to read %s: %w", input, err)
 	}
 
-	if disabled {
+	if disabled || (o.Unescape && noHydrate(byteTemplate)) {
 		_, err := output.Write(byteTemplate)
 
 		return err
 	}
 
-	return Hydrate(byteTemplate, output, variables)
+	if noHydrate(byteTemplate) {
+		return escapeTags(byteTemplate, output)
+	}
+
+	if err := o.Hydrate(byteTemplate, output, variables); err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+
+	return nil
 }
 
 // hydrateFiles in a given directory.
-func hydrateFiles(tmpDir string, variables map[string]interface{}, paths []string, disabled bool) ([]string, error) {
+func (o HydrateOptions) hydrateFiles(
+	tmpDir string,
+	variables map[string]interface{},
+	paths []string,
+	disabled bool,
+) ([]string, error) {
 	result := []string{}
 
 	for _, path := range paths {
@@ -223,7 +292,7 @@ func hydrateFiles(tmpDir string, variables map[string]interface{}, paths []strin
 			_ = tmpFile.Close()
 		}()
 
-		if err := hydrate(path, tmpFile, variables, disabled); err != nil {
+		if err := o.hydrate(path, tmpFile, variables, disabled); err != nil {
 			return nil, fmt.Errorf("failed to hydrate: %w", err)
 		}
 
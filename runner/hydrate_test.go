@@ -2,6 +2,7 @@ package runner_test
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,6 +18,8 @@ type hydrateTestCase struct {
 	InputVars      map[string]interface{}
 	Success        bool
 	ExpectedResult string
+	// ExpectedTag: yaml tag of the hydrated scalar node, if set
+	ExpectedTag string
 }
 
 func TestHydrateScalarNode(t *testing.T) {
@@ -42,6 +45,85 @@ func TestHydrateScalarNode(t *testing.T) {
 			Success:        true,
 			ExpectedResult: "toot:443",
 		},
+		{
+			Name:           "default-unused",
+			InputYaml:      `<[replicas | default 3]>`,
+			InputVars:      map[string]interface{}{"replicas": 5},
+			Success:        true,
+			ExpectedResult: "5",
+			ExpectedTag:    "!!int",
+		},
+		{
+			Name:           "default-brackets",
+			InputYaml:      `<[tags | default "[latest]"]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: "[latest]",
+			ExpectedTag:    "!!str",
+		},
+		{
+			Name:           "default-int",
+			InputYaml:      `<[replicas | default 3]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: "3",
+			ExpectedTag:    "!!int",
+		},
+		{
+			Name:           "default-bool",
+			InputYaml:      `<[app.debug | default true]>`,
+			InputVars:      map[string]interface{}{"app": map[string]interface{}{}},
+			Success:        true,
+			ExpectedResult: "true",
+			ExpectedTag:    "!!bool",
+		},
+		{
+			Name:           "default-quoted",
+			InputYaml:      `<[image | default "nginx | latest"]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: "nginx | latest",
+			ExpectedTag:    "!!str",
+		},
+		{
+			Name:           "default-in-string",
+			InputYaml:      `<[host]>:<[port | default 80]>`,
+			InputVars:      map[string]interface{}{"host": "toot"},
+			Success:        true,
+			ExpectedResult: "toot:80",
+		},
+		{
+			Name:      "missing",
+			InputYaml: `<[replicas]>`,
+			InputVars: map[string]interface{}{},
+			Success:   false,
+		},
+		{
+			Name:      "required",
+			InputYaml: `<[db.password | required "set it in the env layer"]>`,
+			InputVars: map[string]interface{}{},
+			Success:   false,
+		},
+		{
+			Name:           "required-set",
+			InputYaml:      `<[db.password | required "set it in the env layer"]>`,
+			InputVars:      map[string]interface{}{"db": map[string]interface{}{"password": "secret"}},
+			Success:        true,
+			ExpectedResult: "secret",
+		},
+		{
+			Name:           "sha-placeholder",
+			InputYaml:      `<[sha.configmap | trunc 8]>`,
+			InputVars:      map[string]interface{}{"sha": map[string]interface{}{"configmap": "<[sha.configmap]>"}},
+			Success:        true,
+			ExpectedResult: "<[sha.configmap | trunc 8]>",
+		},
+		{
+			Name:      "unknown-filter",
+			InputYaml: `<[replicas | defualt 3]>`,
+			InputVars: map[string]interface{}{},
+			Success:   false,
+		},
 	}
 
 	for _, tcase := range testCases {
@@ -50,10 +132,20 @@ func TestHydrateScalarNode(t *testing.T) {
 
 			require.NoError(t, yaml.Unmarshal([]byte(tcase.InputYaml), &node))
 
-			// hydrate must work
-			require.NoError(t, runner.HydrateScalarNode(node.Content[0], tcase.InputVars))
+			err := runner.HydrateScalarNode(node.Content[0], tcase.InputVars)
+			if !tcase.Success {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
 
 			assert.Equal(t, tcase.ExpectedResult, node.Content[0].Value)
+
+			if tcase.ExpectedTag != "" {
+				assert.Equal(t, tcase.ExpectedTag, node.Content[0].Tag)
+			}
 		})
 	}
 }
@@ -67,16 +159,247 @@ func TestHydrateString(t *testing.T) {
 			Success:        true,
 			ExpectedResult: "toot:443",
 		},
+		{
+			Name:           "escaped",
+			InputYaml:      `\<[host]> is <[host]>`,
+			InputVars:      map[string]interface{}{"host": "toot"},
+			Success:        true,
+			ExpectedResult: `\<[host]> is toot`,
+		},
+		{
+			Name:           "escaped-unbalanced",
+			InputYaml:      `if [[ $a \<[ 3 ]]; then echo <[host]>; fi`,
+			InputVars:      map[string]interface{}{"host": "toot"},
+			Success:        true,
+			ExpectedResult: `if [[ $a \<[ 3 ]]; then echo toot; fi`,
+		},
+		{
+			Name:           "default",
+			InputYaml:      `namespace-<[env | default "dev"]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: "namespace-dev",
+		},
+		{
+			Name:           "default-bool",
+			InputYaml:      `<[disabled | default false]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: "false\n",
+		},
+		{
+			Name:      "required",
+			InputYaml: `<[env | required "env must be set"]>`,
+			InputVars: map[string]interface{}{},
+			Success:   false,
+		},
+		{
+			Name:           "b64enc",
+			InputYaml:      `password: <[db.password | b64enc]>`,
+			InputVars:      map[string]interface{}{"db": map[string]interface{}{"password": "secret"}},
+			Success:        true,
+			ExpectedResult: "password: c2VjcmV0",
+		},
+		{
+			Name:           "pipeline",
+			InputYaml:      `<[branch | slug | trunc 10]>.example.com`,
+			InputVars:      map[string]interface{}{"branch": "Feature/My_Long Branch"},
+			Success:        true,
+			ExpectedResult: "feature-my.example.com",
+		},
+		{
+			Name:           "default-then-filter",
+			InputYaml:      `<[env | default "Dev" | lower | quote]>`,
+			InputVars:      map[string]interface{}{},
+			Success:        true,
+			ExpectedResult: `"dev"`,
+		},
+		{
+			Name:           "toJson",
+			InputYaml:      `ENV=<[env | toJson]>`,
+			InputVars:      map[string]interface{}{"env": map[string]interface{}{"a": 1}},
+			Success:        true,
+			ExpectedResult: `ENV={"a":1}`,
+		},
+		{
+			Name:           "sha256",
+			InputYaml:      `<[name | sha256 | trunc 8]>`,
+			InputVars:      map[string]interface{}{"name": "beaver"},
+			Success:        true,
+			ExpectedResult: "71da248c",
+		},
+		{
+			Name:           "replace-squote",
+			InputYaml:      `<[name | replace "-" "_" | upper | squote]>`,
+			InputVars:      map[string]interface{}{"name": "it's-a-b"},
+			Success:        true,
+			ExpectedResult: `'IT''S_A_B'`,
+		},
+		{
+			Name:           "quoted-brackets",
+			InputYaml:      `<[name | replace "-" "]>"]> and <[name | replace "-" "<[" | default "[x]"]>`,
+			InputVars:      map[string]interface{}{"name": "a-b"},
+			Success:        true,
+			ExpectedResult: `a]>b and a\<[b`,
+		},
+		{
+			Name:           "filter-escaped",
+			InputYaml:      `<[script | b64enc]>`,
+			InputVars:      map[string]interface{}{"script": `echo \<[x]>`},
+			Success:        true,
+			ExpectedResult: "ZWNobyA8W3hdPg==",
+		},
+		{
+			Name:      "unterminated",
+			InputYaml: `<[name | default "]>`,
+			InputVars: map[string]interface{}{"name": "beaver"},
+			Success:   false,
+		},
+		{
+			Name:      "unknown-filter",
+			InputYaml: `<[name | b64]>`,
+			InputVars: map[string]interface{}{"name": "beaver"},
+			Success:   false,
+		},
+		{
+			Name:      "filter-arguments",
+			InputYaml: `<[name | trunc]>`,
+			InputVars: map[string]interface{}{"name": "beaver"},
+			Success:   false,
+		},
+		{
+			Name:      "filter-on-map",
+			InputYaml: `<[env | upper]>`,
+			InputVars: map[string]interface{}{"env": map[string]interface{}{"a": 1}},
+			Success:   false,
+		},
 	}
 
 	for _, tcase := range testCases {
 		t.Run(tcase.Name, func(t *testing.T) {
 			b := []byte{}
 			buf := bytes.NewBuffer(b)
-			// hydrate must work
-			require.NoError(t, runner.HydrateString(tcase.InputYaml, buf, tcase.InputVars))
+
+			err := runner.HydrateString(tcase.InputYaml, buf, tcase.InputVars)
+			if !tcase.Success {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
 
 			assert.Equal(t, tcase.ExpectedResult, buf.String())
 		})
 	}
 }
+
+func TestHydrateReferences(t *testing.T) {
+	chain := func(n int) map[string]interface{} {
+		variables := map[string]interface{}{"v0": "end"}
+		for i := 1; i <= n; i++ {
+			variables[fmt.Sprintf("v%d", i)] = fmt.Sprintf("<[v%d]>", i-1)
+		}
+
+		return variables
+	}
+
+	testCases := []struct {
+		Name      string
+		Input     string
+		Variables map[string]interface{}
+		MaxDepth  int
+		Expected  string
+		Error     string
+	}{
+		{
+			Name:  "nested",
+			Input: "<[url]>",
+			Variables: map[string]interface{}{
+				"url":    "https://<[host]>:<[port]>",
+				"host":   "api.<[domain]>",
+				"domain": "example.com",
+				"port":   443,
+			},
+			Expected: "https://api.example.com:443",
+		},
+		{
+			Name:      "nested-with-filter",
+			Input:     "<[host | upper]>",
+			Variables: map[string]interface{}{"host": "api.<[domain]>", "domain": "example.com"},
+			Expected:  "API.EXAMPLE.COM",
+		},
+		{
+			Name:      "self",
+			Input:     "<[a]>",
+			Variables: map[string]interface{}{"a": "x<[a]>"},
+			Error:     "recursive variable reference: a -> a",
+		},
+		{
+			Name:      "mutual",
+			Input:     "value: <[a]>",
+			Variables: map[string]interface{}{"a": "<[b]>", "b": "<[c]>-", "c": "<[a]>"},
+			Error:     "recursive variable reference: a -> b -> c -> a",
+		},
+		{
+			Name:      "depth",
+			Input:     "<[v5]>",
+			Variables: chain(5),
+			MaxDepth:  5,
+			Expected:  "end",
+		},
+		{
+			Name:      "too-deep",
+			Input:     "<[v6]>",
+			Variables: chain(6),
+			MaxDepth:  5,
+			Error:     "maximum variable expansion depth (5) exceeded: v6 -> v5 -> v4 -> v3 -> v2 -> v1",
+		},
+		{
+			Name:      "sha-placeholder",
+			Input:     "<[sha.cm]>-<[sha.cm | trunc 8]>",
+			Variables: map[string]interface{}{"sha": map[string]interface{}{"cm": "<[sha.cm]>"}},
+			Expected:  "<[sha.cm]>-<[sha.cm | trunc 8]>",
+		},
+	}
+
+	for _, tcase := range testCases {
+		options := runner.HydrateOptions{MaxDepth: tcase.MaxDepth}
+
+		t.Run(tcase.Name+"/string", func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := options.HydrateString(tcase.Input, &buf, tcase.Variables)
+			if tcase.Error != "" {
+				require.ErrorContains(t, err, tcase.Error)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tcase.Expected, buf.String())
+		})
+
+		t.Run(tcase.Name+"/scalar", func(t *testing.T) {
+			node := yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tcase.Input}
+
+			err := options.HydrateScalarNode(&node, tcase.Variables)
+			if tcase.Error != "" {
+				require.ErrorContains(t, err, tcase.Error)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tcase.Expected, node.Value)
+		})
+	}
+
+	t.Run("typed", func(t *testing.T) {
+		node := yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "<[replicas]>"}
+
+		require.NoError(t, runner.HydrateScalarNode(&node, map[string]interface{}{"replicas": "<[count]>", "count": 3}))
+		assert.Equal(t, "!!int", node.Tag)
+		assert.Equal(t, "3", node.Value)
+	})
+}
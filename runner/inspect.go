@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"sort"
+)
+
+// Inspection is a serializable view of a loaded CmdConfig.
+type Inspection struct {
+	RootDir        string                    `json:"rootDir" yaml:"rootDir"`
+	Namespace      string                    `json:"namespace" yaml:"namespace"`
+	Layers         []string                  `json:"layers" yaml:"layers"`
+	VariablesFiles []string                  `json:"variablesFiles" yaml:"variablesFiles"`
+	Variables      map[string]interface{}    `json:"variables" yaml:"variables"`
+	Charts         map[string]InspectedChart `json:"charts" yaml:"charts"`
+	Ytt            []string                  `json:"ytt" yaml:"ytt"`
+	Creates        []InspectedCreate         `json:"creates" yaml:"creates"`
+	Shas           []InspectedSha            `json:"shas" yaml:"shas"`
+	Env            []EnvRead                 `json:"env" yaml:"env"`
+}
+
+// InspectedChart is the resolved definition of a chart.
+type InspectedChart struct {
+	Type       string   `json:"type" yaml:"type"`
+	Path       string   `json:"path" yaml:"path"`
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Namespace  string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Disabled   string   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	ValueFiles []string `json:"valueFiles" yaml:"valueFiles"`
+	Include    []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude    []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Command    []string `json:"command,omitempty" yaml:"command,omitempty"`
+	// HelmArgs: the helm template arguments of the helm options
+	HelmArgs []string `json:"helmArgs,omitempty" yaml:"helmArgs,omitempty"`
+}
+
+// InspectedCreate is the resolved definition of a kubectl create command.
+type InspectedCreate struct {
+	Type string `json:"type" yaml:"type"`
+	Name string `json:"name" yaml:"name"`
+	Dir  string `json:"dir" yaml:"dir"`
+	Args []Arg  `json:"args" yaml:"args"`
+}
+
+// InspectedSha is the resolved definition of a sha variable.
+type InspectedSha struct {
+	Key      string `json:"key" yaml:"key"`
+	Resource string `json:"resource" yaml:"resource"`
+}
+
+// Inspect returns a serializable view of the config, it is meant to be
+// called after Load.
+func (c *CmdConfig) Inspect() *Inspection {
+	inspection := Inspection{
+		RootDir:        c.RootDir,
+		Namespace:      c.Namespace,
+		Layers:         c.Layers,
+		VariablesFiles: append([]string{}, c.Spec.VariablesFiles...),
+		Variables:      make(map[string]interface{}),
+		Charts:         make(map[string]InspectedChart),
+		Ytt:            c.Spec.Ytt,
+		Creates:        []InspectedCreate{},
+		Shas:           []InspectedSha{},
+		Env:            append([]EnvRead{}, c.Spec.EnvReads...),
+	}
+
+	for _, variable := range c.Spec.Variables {
+		inspection.Variables[variable.Name] = variable.Value
+	}
+
+	for name, chart := range c.Spec.Charts {
+		valueFiles := chart.ValuesFileNames
+		if valueFiles == nil {
+			valueFiles = []string{}
+		}
+
+		inspection.Charts[name] = InspectedChart{
+			Type:       chart.Type,
+			Path:       chart.Path,
+			Name:       chart.Name,
+			Namespace:  chart.Namespace,
+			Disabled:   chart.Disabled,
+			ValueFiles: valueFiles,
+			Include:    chart.Include,
+			Exclude:    chart.Exclude,
+			Command:    chart.Command,
+			HelmArgs:   helmOptionArgs(chart),
+		}
+	}
+
+	for key, create := range c.Spec.Creates {
+		inspection.Creates = append(inspection.Creates, InspectedCreate{
+			Type: key.Type,
+			Name: key.Name,
+			Dir:  create.Dir,
+			Args: create.Args,
+		})
+	}
+
+	sort.Slice(inspection.Creates, func(i, j int) bool {
+		if inspection.Creates[i].Type != inspection.Creates[j].Type {
+			return inspection.Creates[i].Type < inspection.Creates[j].Type
+		}
+
+		return inspection.Creates[i].Name < inspection.Creates[j].Name
+	})
+
+	for _, sha := range c.Spec.Shas {
+		inspection.Shas = append(inspection.Shas, InspectedSha{Key: sha.Key, Resource: sha.Resource})
+	}
+
+	return &inspection
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	beaver "orus.io/orus-io/beaver/lib"
+)
+
+// layerNode is a loaded beaver project along with the projects it inherits.
+type layerNode struct {
+	dir    string
+	config *Config
+	// parents: absolute dirs of the inherited projects, `inherits` entries
+	// first and `inherit` last, by decreasing priority
+	parents []string
+}
+
+// layerGraph loads beaver projects and resolves their inheritance.
+//
+// The layers of a project are linearized with the C3 algorithm (the one used
+// by Python for its method resolution order): a project comes before the
+// projects it inherits, its parents keep their declaration order, and a
+// project inherited by several others (a diamond) appears only once, after
+// all of them. The resulting list goes from the most specific project to the
+// most generic one, layers are then applied in reverse order so that the
+// most specific project wins.
+type layerGraph struct {
+	load func(dir string) (*Config, error)
+	// cache: shares the loaded layers with other graphs, may be nil
+	cache *Cache
+	// overrides: variables overlaid on the ones of each layer to hydrate the
+	// paths it inherits
+	overrides Variables
+	nodes     map[string]*layerNode
+	linear    map[string][]string
+}
+
+func newLayerGraph(load func(dir string) (*Config, error), cache *Cache) *layerGraph {
+	return &layerGraph{
+		load:   load,
+		cache:  cache,
+		nodes:  make(map[string]*layerNode),
+		linear: make(map[string][]string),
+	}
+}
+
+// node loads the project found in an absolute dir, only once.
+func (g *layerGraph) node(dir string) (*layerNode, error) {
+	if node, ok := g.nodes[dir]; ok {
+		return node, nil
+	}
+
+	node, err := g.cache.layerNode(dir, func() (*layerNode, error) { return g.loadNode(dir) })
+	if err != nil {
+		return nil, err
+	}
+
+	g.nodes[dir] = node
+
+	return node, nil
+}
+
+// loadNode loads the project found in an absolute dir. The loaded node is
+// shared through the cache, it must not be modified afterwards.
+func (g *layerGraph) loadNode(dir string) (*layerNode, error) {
+	config, err := g.load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config from %s: %w", dir, err)
+	}
+
+	config.Dir = dir
+
+	if config.BeaverVersion != "" && beaver.Version() != "" {
+		if err := beaver.ControlVersions(config.BeaverVersion, beaver.Version()); err != nil {
+			return nil, fmt.Errorf("beaverversion of %s (layer %s): %w", config.File, dir, err)
+		}
+	}
+
+	parents, err := config.parentDirs(dir, g.overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	return &layerNode{dir: dir, config: config, parents: parents}, nil
+}
+
+// linearize returns the layers of the project found in an absolute dir, from
+// the most specific to the most generic one.
+func (g *layerGraph) linearize(dir string) ([]string, error) {
+	return g.linearizeFrom(dir, nil)
+}
+
+func (g *layerGraph) linearizeFrom(dir string, path []string) ([]string, error) {
+	if linear, ok := g.linear[dir]; ok {
+		return linear, nil
+	}
+
+	// guard against recursive inherit loops
+	for i, p := range path {
+		if p == dir {
+			cycle := append(path[i:len(path):len(path)], dir)
+
+			return nil, fmt.Errorf("recursive inherit loop detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	node, err := g.node(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	path = append(path[:len(path):len(path)], dir)
+
+	sequences := make([][]string, 0, len(node.parents)+1)
+
+	for _, parent := range node.parents {
+		linear, err := g.linearizeFrom(parent, path)
+		if err != nil {
+			return nil, err
+		}
+
+		sequences = append(sequences, linear)
+	}
+
+	sequences = append(sequences, node.parents)
+
+	merged, err := c3Merge(sequences)
+	if err != nil {
+		return nil, fmt.Errorf("cannot linearize the layers of %s: %w", dir, err)
+	}
+
+	linear := append([]string{dir}, merged...)
+	g.linear[dir] = linear
+
+	return linear, nil
+}
+
+// c3Merge merges linearizations: it repeatedly takes the first head that
+// does not appear in the tail of any sequence.
+func c3Merge(sequences [][]string) ([]string, error) {
+	var result []string
+
+	seqs := make([][]string, 0, len(sequences))
+
+	for _, seq := range sequences {
+		if len(seq) > 0 {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	for len(seqs) > 0 {
+		var candidate string
+
+		for _, seq := range seqs {
+			if !inTails(seqs, seq[0]) {
+				candidate = seq[0]
+
+				break
+			}
+		}
+
+		if candidate == "" {
+			heads := make([]string, 0, len(seqs))
+			for _, seq := range seqs {
+				heads = append(heads, seq[0])
+			}
+
+			return nil, fmt.Errorf("inconsistent inherit order between %s", strings.Join(heads, ", "))
+		}
+
+		result = append(result, candidate)
+
+		next := seqs[:0]
+
+		for _, seq := range seqs {
+			if seq[0] == candidate {
+				seq = seq[1:]
+			}
+
+			if len(seq) > 0 {
+				next = append(next, seq)
+			}
+		}
+
+		seqs = next
+	}
+
+	return result, nil
+}
+
+func inTails(seqs [][]string, dir string) bool {
+	for _, seq := range seqs {
+		if contains(seq[1:], dir) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -41,32 +42,61 @@ func NewRunner(cfg *CmdConfig) *Runner {
 
 // Build is in charge of applying commands based on the config data.
 func (r *Runner) Build(tmpDir string) error {
+	outputDir, err := r.OutputDir()
+	if err != nil {
+		return err
+	}
+
+	return r.BuildTo(tmpDir, outputDir)
+}
+
+// OutputDir returns the directory in which Build writes the resources, it is
+// either the configured output or `build/<namespace>` inside the root dir.
+func (r *Runner) OutputDir() (string, error) {
 	variables, err := r.config.prepareVariables(false)
 	if err != nil {
-		return fmt.Errorf("cannot prepare variables: %w", err)
+		return "", fmt.Errorf("cannot prepare variables: %w", err)
 	}
 
-	var outputDir string
+	w := bytes.NewBuffer([]byte{})
+	if err := r.config.hydrateOptions(false).HydrateString(r.config.Namespace, w, variables); err != nil {
+		return "", err
+	}
 
-	if err := r.config.HelmDependencyBuild(); err != nil {
-		return err
+	r.config.Namespace = w.String()
+
+	if r.config.Output != "" {
+		return r.config.Output, nil
 	}
 
-	if r.config.Output == "" {
-		w := bytes.NewBuffer([]byte{})
-		if err := HydrateString(r.config.Namespace, w, variables); err != nil {
-			return err
+	return filepath.Join(r.config.RootDir, "build", r.config.Namespace), nil
+}
+
+// BuildTo builds the resources into the given output directory, which is
+// cleaned first unless it is `stdout`.
+func (r *Runner) BuildTo(tmpDir, outputDir string) error {
+	variables, err := r.config.prepareVariables(false)
+	if err != nil {
+		return fmt.Errorf("cannot prepare variables: %w", err)
+	}
+
+	if r.config.DryRun {
+		for _, read := range r.config.Spec.EnvReads {
+			r.config.Logger.Info().
+				Str("name", read.Name).
+				Str("source", read.Source).
+				Msg("read environment variable")
 		}
+	}
 
-		r.config.Namespace = w.String()
-		outputDir = filepath.Join(r.config.RootDir, "build", r.config.Namespace)
-	} else {
-		outputDir = r.config.Output
+	if err := r.config.HelmDependencyBuild(); err != nil {
+		return err
 	}
 
 	for name := range r.config.Spec.Charts {
 		w := bytes.NewBuffer([]byte{})
-		if err := HydrateString(r.config.Spec.Charts[name].Disabled, w, variables); err != nil {
+		err := r.config.hydrateOptions(false).HydrateString(r.config.Spec.Charts[name].Disabled, w, variables)
+		if err != nil {
 			return err
 		}
 
@@ -112,7 +142,7 @@ func (r *Runner) Build(tmpDir string) error {
 			outFile = os.Stdout
 		} else {
 			var outputFileName bytes.Buffer
-			if err := Hydrate([]byte(file.Name()), &outputFileName, variables); err != nil {
+			if err := r.config.hydrateOptions(true).Hydrate([]byte(file.Name()), &outputFileName, variables); err != nil {
 				return fmt.Errorf("cannot hydrate file name: %w", err)
 			}
 
@@ -130,7 +160,8 @@ func (r *Runner) Build(tmpDir string) error {
 			}()
 		}
 
-		if err := hydrate(inFilePath, outFile, variables, r.config.WithoutHydrate); err != nil {
+		// last hydration of the build
+		if err := r.config.hydrateOptions(true).hydrate(inFilePath, outFile, variables, r.config.WithoutHydrate); err != nil {
 			return fmt.Errorf("cannot hydrate: %s - %w", outFilePath, err)
 		}
 	}
@@ -139,7 +170,7 @@ func (r *Runner) Build(tmpDir string) error {
 }
 
 func (r *Runner) DoBuild(tmpDir, outputDir string) error {
-	cmds, err := r.prepareCmds()
+	cmds, renders, err := r.prepareCmds()
 	if err != nil {
 		return err
 	}
@@ -149,6 +180,13 @@ func (r *Runner) DoBuild(tmpDir, outputDir string) error {
 		return err
 	}
 
+	rendered, err := r.renderCharts(tmpDir, renders)
+	if err != nil {
+		return err
+	}
+
+	compiled = append(compiled, rendered...)
+
 	yttOutput, err := r.runYtt(tmpDir, compiled)
 	if err != nil {
 		return err
@@ -174,6 +212,10 @@ func (r *Runner) DoBuild(tmpDir, outputDir string) error {
 	return nil
 }
 
+// kustomize hydrates the kustomization files of the layers into a copy of
+// their kustomize folders in tmpDir, and runs kustomize on the last one. The
+// copies keep their relative places, so a kustomization can refer to the
+// kustomize folder of another layer, and the layers are never written to.
 func (r *Runner) kustomize(tmpDir string, input *os.File) (*os.File, error) {
 	kustomizeFilePath := filepath.Join(tmpDir, "kustomization.yaml")
 
@@ -194,38 +236,45 @@ func (r *Runner) kustomize(tmpDir string, input *os.File) (*os.File, error) {
 
 	var lastKustomizeFolder string
 
+	root := commonDir(r.config.Layers)
+	copied := false
+
 	for _, layer := range r.config.Layers {
+		srcDir := filepath.Join(layer, "kustomize")
+
+		if stat, err := os.Stat(srcDir); err != nil || !stat.IsDir() {
+			continue
+		}
+
+		if !copied {
+			if err := r.copyLayers(root, tmpDir); err != nil {
+				return nil, err
+			}
+
+			copied = true
+		}
+
+		relLayer, err := filepath.Rel(root, layer)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find relative path for: %s - %w", layer, err)
+		}
+
+		dstDir := filepath.Join(tmpDir, "kustomize", relLayer, "kustomize")
+
 		for _, ext := range []string{"yml", "yaml"} {
 			fName := "kustomization." + ext
-			fPath := filepath.Join(layer, "kustomize", fName)
+			fPath := filepath.Join(srcDir, fName)
 
 			fStat, err := os.Stat(fPath)
 			if err != nil || fStat.IsDir() {
 				continue
 			}
 
-			backupFile := fPath + ".back"
-			if err := Copy(fPath, backupFile); err != nil {
-				return nil, fmt.Errorf("cannot copy kustomization file: %w", err)
-			}
-
-			defer func(fPath string) {
-				if err := Copy(backupFile, fPath); err != nil {
-					r.config.Logger.Fatal().Err(err).Msg("cannot restore kustomization back file")
-				}
-
-				if err := os.Remove(backupFile); err != nil {
-					r.config.Logger.Fatal().Err(err).Msg("cannot remove kustomization back file")
-				}
-			}(fPath)
-
-			if err := os.Remove(fPath); err != nil {
-				return nil, fmt.Errorf("cannot remove original kustomization file: %w", err)
-			}
+			outPath := filepath.Join(dstDir, fName)
 
-			outFile, err := os.Create(fPath)
+			outFile, err := os.Create(outPath)
 			if err != nil {
-				return nil, fmt.Errorf("cannot open: %s - %w", fPath, err)
+				return nil, fmt.Errorf("cannot open: %s - %w", outPath, err)
 			}
 
 			defer func() {
@@ -235,7 +284,7 @@ func (r *Runner) kustomize(tmpDir string, input *os.File) (*os.File, error) {
 			}()
 
 			// kustomize root cannot be absolute
-			RelInputFilePath, err := filepath.Rel(filepath.Join(layer, "kustomize"), tmpDir)
+			RelInputFilePath, err := filepath.Rel(dstDir, tmpDir)
 			if err != nil {
 				return nil, fmt.Errorf("cannot find relative path for: %s - %w", tmpDir, err)
 			}
@@ -244,11 +293,12 @@ func (r *Runner) kustomize(tmpDir string, input *os.File) (*os.File, error) {
 				"build": RelInputFilePath,
 			}
 
-			if err := hydrate(backupFile, outFile, variables, r.config.WithoutHydrate); err != nil {
+			err = r.config.hydrateOptions(false).hydrate(fPath, outFile, variables, r.config.WithoutHydrate)
+			if err != nil {
 				return nil, fmt.Errorf("cannot hydrate: %s - %w", fPath, err)
 			}
 
-			lastKustomizeFolder = filepath.Join(layer, "kustomize")
+			lastKustomizeFolder = dstDir
 		}
 	}
 
@@ -263,6 +313,55 @@ func (r *Runner) kustomize(tmpDir string, input *os.File) (*os.File, error) {
 	return input, nil
 }
 
+// commonDir returns the deepest directory containing all the given absolute
+// dirs.
+// copyLayers copies the layers into the kustomize directory of the build temp
+// directory, keeping their places relative to root, so that the kustomize
+// folders can refer to any file of the layers once hydrated. The paths written
+// by the builds are left out.
+func (r *Runner) copyLayers(root, tmpDir string) error {
+	ignored, err := r.IgnoredPaths()
+	if err != nil {
+		return err
+	}
+
+	ignored = append(ignored, tmpDir)
+
+	for _, layer := range r.config.Layers {
+		relLayer, err := filepath.Rel(root, layer)
+		if err != nil {
+			return fmt.Errorf("cannot find relative path for: %s - %w", layer, err)
+		}
+
+		if err := CopyDir(layer, filepath.Join(tmpDir, "kustomize", relLayer), ignored); err != nil {
+			return fmt.Errorf("cannot copy layer %s: %w", layer, err)
+		}
+	}
+
+	return nil
+}
+
+func commonDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return string(filepath.Separator)
+	}
+
+	common := filepath.Clean(dirs[0])
+
+	for _, dir := range dirs[1:] {
+		dir = filepath.Clean(dir)
+		for common != filepath.Dir(common) {
+			if inPaths(dir, []string{common}) {
+				break
+			}
+
+			common = filepath.Dir(common)
+		}
+	}
+
+	return common
+}
+
 func ToBool(s string) (bool, error) {
 	sLower := strings.ToLower(s)
 	finalString := strings.TrimSuffix(sLower, "\n")
@@ -277,33 +376,46 @@ func ToBool(s string) (bool, error) {
 	}
 }
 
-func (r *Runner) prepareCmds() (map[string]*cmd.Cmd, error) {
-	// create helm commands
-	// create ytt chart commands
+// prepareCmds returns the commands of the enabled charts and of the create
+// entries, along with the charts their engine renders without any command.
+func (r *Runner) prepareCmds() (map[string]*cmd.Cmd, map[string]ChartContext, error) {
+	variables, err := r.config.prepareVariables(false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot prepare variables: %w", err)
+	}
+
 	cmds := make(map[string]*cmd.Cmd)
+	renders := make(map[string]ChartContext)
 
 	for name, chart := range r.config.Spec.Charts {
 		disabled, err := ToBool(chart.Disabled)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if disabled {
 			continue
 		}
 
-		args, err := chart.BuildArgs(name, r.config.Namespace)
+		engine, ok := LookupEngine(chart.Type)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported chart %s type: %q", chart.Path, chart.Type)
+		}
+
+		chartContext := newChartContext(name, chart, r.config.Namespace)
+		chartContext.Hydrate = func(path string, w io.Writer) error {
+			return r.config.hydrateOptions(false).hydrate(path, w, variables, r.config.WithoutHydrate)
+		}
+
+		command, err := engine.Command(chartContext)
 		if err != nil {
-			return nil, fmt.Errorf("build: failed to build args %w", err)
+			return nil, nil, fmt.Errorf("build: failed to build command: %w", err)
 		}
 
-		switch chart.Type {
-		case HelmType:
-			cmds[name] = cmd.NewCmd(helmCmd, args...)
-		case YttType:
-			cmds[name] = cmd.NewCmd(yttCmd, args...)
-		default:
-			return nil, fmt.Errorf("unsupported chart %s type: %q", chart.Path, chart.Type)
+		if command == nil {
+			renders[name] = chartContext
+		} else {
+			cmds[name] = command
 		}
 	}
 
@@ -315,7 +427,7 @@ func (r *Runner) prepareCmds() (map[string]*cmd.Cmd, error) {
 		cmds[name] = c
 	}
 
-	return cmds, nil
+	return cmds, renders, nil
 }
 
 func (r *Runner) runCommand(tmpDir, name string, cmd *cmd.Cmd) (*os.File, error) {
@@ -410,6 +522,56 @@ func (r *Runner) runCommands(tmpDir string, cmds map[string]*cmd.Cmd) ([]string,
 	}
 }
 
+// renderCharts renders the charts whose engine has no command, there is one
+// compiled file per chart, like the outputs of runCommands.
+func (r *Runner) renderCharts(tmpDir string, charts map[string]ChartContext) ([]string, error) {
+	compiled := make([]string, 0, len(charts))
+
+	for name, chart := range charts {
+		engine, ok := LookupEngine(chart.Chart.Type)
+		if !ok {
+			return nil, fmt.Errorf("unsupported chart %s type: %q", chart.Chart.Path, chart.Chart.Type)
+		}
+
+		r.config.Logger.Debug().
+			Str("chart", name).
+			Str("type", chart.Chart.Type).
+			Msg("rendering chart")
+
+		output, err := r.renderChart(tmpDir, engine, chart)
+		if err != nil {
+			return nil, fmt.Errorf("%s chart %s: %w", chart.Chart.Type, name, err)
+		}
+
+		compiled = append(compiled, output)
+	}
+
+	return compiled, nil
+}
+
+// renderChart renders a chart into a compiled file.
+func (r *Runner) renderChart(tmpDir string, engine Engine, chart ChartContext) (string, error) {
+	tmpFile, err := os.CreateTemp(tmpDir, fmt.Sprintf("compiled-%s-*.yaml", chart.Key))
+	if err != nil {
+		return "", fmt.Errorf("cannot create compiled file: %w", err)
+	}
+
+	defer func() {
+		if err := tmpFile.Close(); err != nil {
+			r.config.Logger.
+				Err(err).
+				Str("temp file", tmpFile.Name()).
+				Msg("failed to close temp file")
+		}
+	}()
+
+	if err := engine.Render(chart, tmpFile); err != nil {
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
 func (r *Runner) runYtt(tmpDir string, compiled []string) (*os.File, error) {
 	// create ytt additional command
 	args := r.config.BuildYttArgs(r.config.Spec.Ytt, compiled)
@@ -452,6 +614,37 @@ func Copy(src, dst string) error {
 	return out.Close()
 }
 
+// CopyDir copies the files of the src directory tree into dst, except the
+// ignored paths and the `.beaver-` build temp directories.
+func CopyDir(src, dst string, ignored []string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if inPaths(path, ignored) || (entry.IsDir() && strings.HasPrefix(entry.Name(), ".beaver-")) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, defaultDirMod)
+		}
+
+		return Copy(path, target)
+	})
+}
+
 // YamlSplit takes a buildDir and an inputFile
 // it returns a list of yaml documents and an eventual error.
 func YamlSplit(buildDir, inputFile string) ([]string, error) {
@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultManifestsInclude are the files of a manifests chart rendered when
+// it has no include patterns.
+var defaultManifestsInclude = []string{"*.yaml", "*.yml"}
+
+// renderManifests hydrates the files of a manifests chart, separated by
+// `---`.
+func renderManifests(chart ChartContext, w io.Writer) error {
+	if err := noValuesFiles(chart); err != nil {
+		return err
+	}
+
+	files, err := chart.Chart.manifestFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		var buf strings.Builder
+
+		if err := chart.Hydrate(file, &buf); err != nil {
+			return err
+		}
+
+		content := buf.String()
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+
+		if _, err := io.WriteString(w, "---\n"+strings.TrimPrefix(content, "---\n")); err != nil {
+			return fmt.Errorf("cannot write manifests: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// manifestFiles returns the files of a manifests chart, sorted by path. The
+// path of the chart is either a file or a directory walked recursively.
+func (c CmdChart) manifestFiles() ([]string, error) {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifests: %w", err)
+	}
+
+	if !info.IsDir() {
+		return []string{c.Path}, nil
+	}
+
+	include := c.Include
+	if len(include) == 0 {
+		include = defaultManifestsInclude
+	}
+
+	var files []string
+
+	err = filepath.WalkDir(c.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == c.Path {
+			return nil
+		}
+
+		rel, err := filepath.Rel(c.Path, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if matchManifest(c.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !d.IsDir() && matchManifest(include, rel) {
+			files = append(files, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list manifests in %s: %w", c.Path, err)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// matchManifest returns true if one of the patterns matches the slash
+// separated path rel. A pattern containing a `/` is matched against rel,
+// the others against its base name.
+func matchManifest(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,172 @@
+package runner
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	// MergeReplace replaces the inherited value, it is the default.
+	MergeReplace = "replace"
+	// MergeDeep recursively merges dicts into the inherited ones, and the
+	// items of a list into the inherited items having the same key.
+	MergeDeep = "deep"
+	// MergeAppend adds the items of a list after the inherited ones.
+	MergeAppend = "append"
+	// MergePrepend adds the items of a list before the inherited ones.
+	MergePrepend = "prepend"
+)
+
+// mergeDirective tells how a variable is merged with its inherited value.
+type mergeDirective struct {
+	strategy string
+	// key: the field identifying the items of a list merged with MergeDeep
+	key string
+}
+
+// mergeDirective returns how the variable is merged with its inherited
+// value, given by its merge and mergeKey settings.
+func (v Variable) mergeDirective() (mergeDirective, error) {
+	strategy := v.Merge
+	if strategy == "" {
+		strategy = MergeReplace
+	}
+
+	switch strategy {
+	case MergeReplace, MergeDeep, MergeAppend, MergePrepend:
+	default:
+		return mergeDirective{}, fmt.Errorf(
+			"variable %s: unknown merge %q, must be one of: %s, %s, %s, %s",
+			v.Name, v.Merge, MergeReplace, MergeDeep, MergeAppend, MergePrepend,
+		)
+	}
+
+	if v.MergeKey != "" && strategy != MergeDeep {
+		return mergeDirective{}, fmt.Errorf("variable %s: mergeKey can only be used with merge: %s", v.Name, MergeDeep)
+	}
+
+	return mergeDirective{strategy: strategy, key: v.MergeKey}, nil
+}
+
+// merge returns the result of merging value into the inherited one.
+func (d mergeDirective) merge(inherited, value interface{}) (interface{}, error) {
+	if d.strategy == MergeReplace || inherited == nil {
+		return value, nil
+	}
+
+	inheritedList, inheritedIsList := inherited.([]interface{})
+
+	switch d.strategy {
+	case MergeAppend, MergePrepend:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot %s a %T, only lists can be", d.strategy, value)
+		}
+
+		if !inheritedIsList {
+			return nil, fmt.Errorf("cannot %s to a %T, not a list", d.strategy, inherited)
+		}
+
+		if d.strategy == MergeAppend {
+			return append(inheritedList[:len(inheritedList):len(inheritedList)], list...), nil
+		}
+
+		return append(list[:len(list):len(list)], inheritedList...), nil
+	default:
+		list, ok := value.([]interface{})
+		if !ok || !inheritedIsList {
+			return deepMerge(inherited, value), nil
+		}
+
+		if d.key == "" {
+			return nil, fmt.Errorf("merging lists needs the key identifying their items, eg. mergeKey: name")
+		}
+
+		return mergeByKey(inheritedList, list, d.key)
+	}
+}
+
+// mergeByKey deep merges each item of src into the item of dst having the
+// same key, the items of src with a new key are appended.
+func mergeByKey(dst, src []interface{}, key string) ([]interface{}, error) {
+	result := append(dst[:0:0], dst...)
+
+	for i, item := range src {
+		value, ok := itemKey(item, key)
+		if !ok {
+			return nil, fmt.Errorf("item %d has no %q key", i, key)
+		}
+
+		found := false
+
+		for j, existing := range result {
+			if existingValue, ok := itemKey(existing, key); ok && reflect.DeepEqual(existingValue, value) {
+				result[j] = deepMerge(existing, item)
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// itemKey returns the value of the key field of a list item, if it is a dict.
+func itemKey(item interface{}, key string) (interface{}, bool) {
+	switch t := item.(type) {
+	case map[string]interface{}:
+		value, ok := t[key]
+
+		return value, ok
+	case map[interface{}]interface{}:
+		value, ok := t[key]
+
+		return value, ok
+	default:
+		return nil, false
+	}
+}
+
+// deepMerge recursively merges the src dicts into the dst ones, any other
+// value of src replaces the one of dst.
+func deepMerge(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return src
+		}
+
+		for key, value := range s {
+			if existing, ok := d[key]; ok {
+				d[key] = deepMerge(existing, value)
+			} else {
+				d[key] = value
+			}
+		}
+
+		return d
+	case map[interface{}]interface{}:
+		d, ok := dst.(map[interface{}]interface{})
+		if !ok {
+			return src
+		}
+
+		for key, value := range s {
+			if existing, ok := d[key]; ok {
+				d[key] = deepMerge(existing, value)
+			} else {
+				d[key] = value
+			}
+		}
+
+		return d
+	default:
+		return src
+	}
+}
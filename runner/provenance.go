@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// OriginDefine is a variable set for the first time.
+	OriginDefine = "define"
+	// OriginReplace is a variable fully replaced by a layer.
+	OriginReplace = "replace"
+	// OriginPartial is a variable partially overlaid with a dotted name.
+	OriginPartial = "partial"
+	// OriginMerge is a variable merged into its inherited value, see
+	// Variable.Merge.
+	OriginMerge = "merge"
+)
+
+// VariableOrigin records a layer setting a variable.
+type VariableOrigin struct {
+	// Path: the variable name as written in the layer, possibly dotted
+	Path string `json:"path" yaml:"path"`
+	// Layer: the config directory that set the variable
+	Layer string `json:"layer" yaml:"layer"`
+	// Kind: one of OriginDefine, OriginReplace, OriginPartial or OriginMerge
+	Kind string `json:"kind" yaml:"kind"`
+}
+
+// VariableProvenance is the final value of a variable path along with the
+// layers that set it.
+type VariableProvenance struct {
+	Path    string           `json:"path" yaml:"path"`
+	Value   interface{}      `json:"value" yaml:"value"`
+	Origins []VariableOrigin `json:"origins" yaml:"origins"`
+}
+
+func (s *CmdSpec) originKind(variable Variable) string {
+	if strings.Contains(variable.Name, ".") {
+		return OriginPartial
+	}
+
+	for _, origin := range s.VariableOrigins {
+		if origin.Path == variable.Name {
+			if variable.Merge != "" && variable.Merge != MergeReplace {
+				return OriginMerge
+			}
+
+			return OriginReplace
+		}
+	}
+
+	return OriginDefine
+}
+
+// VariablesProvenance lists every leaf variable path with its final value
+// and the layers that set it, in merge order. A layer setting a parent path
+// is reported as setting all of its leaves.
+func (c *CmdConfig) VariablesProvenance() []VariableProvenance {
+	var result []VariableProvenance
+
+	for _, variable := range c.Spec.Variables {
+		flattenVariable(variable.Name, variable.Value, func(path string, value interface{}) {
+			provenance := VariableProvenance{Path: path, Value: value, Origins: []VariableOrigin{}}
+
+			for _, origin := range c.Spec.VariableOrigins {
+				if origin.Path == path || strings.HasPrefix(path, origin.Path+".") {
+					provenance.Origins = append(provenance.Origins, origin)
+				}
+			}
+
+			result = append(result, provenance)
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+// flattenVariable calls fn for each leaf of a variable value.
+func flattenVariable(path string, value interface{}, fn func(string, interface{})) {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			break
+		}
+
+		for key, v := range t {
+			flattenVariable(path+"."+key, v, fn)
+		}
+
+		return
+
+	case map[interface{}]interface{}:
+		if len(t) == 0 {
+			break
+		}
+
+		for key, v := range t {
+			flattenVariable(fmt.Sprintf("%s.%v", path, key), v, fn)
+		}
+
+		return
+
+	case []interface{}:
+		if len(t) == 0 {
+			break
+		}
+
+		for i, v := range t {
+			flattenVariable(fmt.Sprintf("%s.%d", path, i), v, fn)
+		}
+
+		return
+	}
+
+	fn(path, value)
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"reflect"
+	"strings"
+)
+
+// schemaOverrides replaces the generated schema of some fields, keyed by
+// `<go type name>.<yaml field name>`.
+var schemaOverrides = map[string]func() map[string]interface{}{
+	// beaverversion: 3.2 is decoded as a number by yaml
+	"Config.beaverversion": func() map[string]interface{} {
+		return map[string]interface{}{"type": []string{"string", "number"}}
+	},
+	"Chart.type": func() map[string]interface{} {
+		return map[string]interface{}{"type": "string", "enum": ChartTypes()}
+	},
+	"Variable.merge": func() map[string]interface{} {
+		return map[string]interface{}{
+			"type": "string",
+			"enum": []string{MergeReplace, MergeDeep, MergeAppend, MergePrepend},
+		}
+	},
+	// helm parses the values itself, yaml scalars are decoded as strings
+	"Chart.set": func() map[string]interface{} {
+		return scalarMapSchema()
+	},
+	"Chart.setString": func() map[string]interface{} {
+		return scalarMapSchema()
+	},
+	// disabled must be castable to bool, or be a beaver variable
+	"Chart.disabled": func() map[string]interface{} {
+		return map[string]interface{}{"type": []string{"string", "boolean", "integer"}}
+	},
+}
+
+// JSONSchema returns a JSON schema of the beaver config files, generated from
+// the Config type so that it always matches the binary.
+func JSONSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "beaver config file"
+
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(Variables{}) {
+		return variablesSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" || name == "" {
+				continue
+			}
+
+			if override, ok := schemaOverrides[t.Name()+"."+name]; ok {
+				properties[name] = override()
+			} else {
+				properties[name] = typeSchema(field.Type)
+			}
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		// interface{} and anything we cannot describe accept any value
+		return map[string]interface{}{}
+	}
+}
+
+// scalarMapSchema describes a map of any scalar values.
+func scalarMapSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": []string{"string", "number", "boolean"}},
+	}
+}
+
+// variablesSchema describes the two syntaxes accepted by
+// Variables.UnmarshalYAML.
+func variablesSchema() map[string]interface{} {
+	item := typeSchema(reflect.TypeOf(Variable{}))
+	item["required"] = []string{"name"}
+
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"description": "legacy list of variables",
+				"type":        "array",
+				"items":       item,
+			},
+			map[string]interface{}{
+				"description": "variables by name",
+				"type":        "object",
+			},
+		},
+	}
+}
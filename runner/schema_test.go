@@ -0,0 +1,59 @@
+package runner_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"orus.io/orus-io/beaver/runner"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema := runner.JSONSchema()
+
+	// the schema must be serializable
+	_, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	properties, ok := schema["properties"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	for _, name := range []string{"inherit", "inherits", "beaverversion", "namespace", "variables", "sha", "charts", "create"} {
+		assert.Contains(t, properties, name)
+	}
+
+	assert.NotContains(t, properties, "Dir")
+
+	variables, ok := properties["variables"].(map[string]interface{})
+	require.True(t, ok)
+	oneOf, ok := variables["oneOf"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, oneOf, 2)
+
+	// every top level key of our fixtures is described by the schema
+	configs, err := filepath.Glob("fixtures/*/*/beaver.y*ml")
+	require.NoError(t, err)
+	require.NotEmpty(t, configs)
+
+	for _, config := range configs {
+		if filepath.Base(filepath.Dir(filepath.Dir(config))) == "fInvalid" {
+			continue
+		}
+
+		content, err := os.ReadFile(config)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(content, &doc))
+
+		for key := range doc {
+			assert.Contains(t, properties, key, "in %s", config)
+		}
+	}
+}
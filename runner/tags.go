@@ -0,0 +1,404 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tagExpression is the content of a beaver tag: a variable path optionally
+// followed by a pipeline of filters, eg. `<[name | default "x"]>`.
+type tagExpression struct {
+	path    string
+	filters []tagFilter
+	// pipeline: the raw text of the filters, eg. `| default "x"`
+	pipeline string
+}
+
+// tagFilter is a filter of a tag pipeline along with its arguments, which
+// are parsed as yaml scalars so that `default 3` gives an int.
+type tagFilter struct {
+	name string
+	args []interface{}
+}
+
+// parseTag parses the content of a beaver tag.
+func parseTag(tag string) (*tagExpression, error) {
+	parts, err := splitTag(tag, '|')
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag %q: %w", tag, err)
+	}
+
+	expr := tagExpression{path: strings.TrimSpace(parts[0]), pipeline: tag[len(parts[0]):]}
+	if expr.path == "" {
+		return nil, fmt.Errorf("invalid tag %q: missing variable name", tag)
+	}
+
+	for _, part := range parts[1:] {
+		words, err := splitTag(strings.TrimSpace(part), ' ')
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %w", tag, err)
+		}
+
+		filter := tagFilter{name: words[0]}
+		if filter.name == "" {
+			return nil, fmt.Errorf("invalid tag %q: empty filter", tag)
+		}
+
+		for _, word := range words[1:] {
+			if word == "" {
+				continue
+			}
+
+			var arg interface{}
+			if err := yaml.Unmarshal([]byte(word), &arg); err != nil {
+				return nil, fmt.Errorf("invalid tag %q: invalid argument %s: %w", tag, word, err)
+			}
+
+			filter.args = append(filter.args, arg)
+		}
+
+		spec, ok := tagFilters[filter.name]
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q: unknown filter %q", tag, filter.name)
+		}
+
+		if len(filter.args) < spec.minArgs || len(filter.args) > spec.maxArgs {
+			return nil, fmt.Errorf("invalid tag %q: %s expects %s, got %d", tag, filter.name, spec.arity(), len(filter.args))
+		}
+
+		expr.filters = append(expr.filters, filter)
+	}
+
+	return &expr, nil
+}
+
+// splitTag splits s around sep, except inside single or double quotes.
+func splitTag(s string, sep rune) ([]string, error) {
+	var (
+		parts   []string
+		current strings.Builder
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+
+	return append(parts, current.String()), nil
+}
+
+// apply runs the value of the tag variable through the filters, found is
+// false when the variable does not exist.
+func (e *tagExpression) apply(value interface{}, found bool) (interface{}, error) {
+	for _, filter := range e.filters {
+		switch filter.name {
+		case "default":
+			if !found || value == nil {
+				value, found = filter.args[0], true
+			}
+		case "required":
+			if !found {
+				if len(filter.args) == 1 {
+					return nil, fmt.Errorf("%s is required: %v", e.path, filter.args[0])
+				}
+
+				return nil, fmt.Errorf("%s is required", e.path)
+			}
+		default:
+			if !found {
+				return nil, fmt.Errorf("tag not found: %s", e.path)
+			}
+
+			// the filters see the escaped tags as the `<[` they stand for,
+			// and the `<[` of their result are escaped again
+			result, err := tagFilters[filter.name].apply(replaceStrings(value, escapedTag, "<["), filter.args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", e.path, filter.name, err)
+			}
+
+			value = replaceStrings(result, "<[", escapedTag)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("tag not found: %s", e.path)
+	}
+
+	return value, nil
+}
+
+// replaceStrings replaces old by new in the strings of value, lists and dicts
+// are walked through and copied.
+func replaceStrings(value interface{}, old, new string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(v, old, new)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+
+		for key, item := range v {
+			result[key] = replaceStrings(item, old, new)
+		}
+
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(v))
+
+		for key, item := range v {
+			result[key] = replaceStrings(item, old, new)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+
+		for i, item := range v {
+			result[i] = replaceStrings(item, old, new)
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+// expansion expands the tags of a hydration, along with the tags found in
+// the values of the variables they reference.
+type expansion struct {
+	variables map[string]interface{}
+	maxDepth  int
+	// keepUnknown leaves the tags of unknown variables as is instead of
+	// failing, they are expanded by a later hydration
+	keepUnknown bool
+}
+
+// lookup evaluates the content of a tag, chain is the list of the variables
+// being expanded which led to it.
+func (x *expansion) lookup(tag string, chain []string) (interface{}, error) {
+	expr, err := parseTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found := LookupVariable(x.variables, expr.path)
+
+	if !found && x.keepUnknown {
+		head, _, _ := strings.Cut(expr.path, ".")
+		if _, ok := x.variables[head]; !ok {
+			return "<[" + tag + "]>", nil
+		}
+	}
+
+	// a sha is only known at the end of the build, until then its variable
+	// is a placeholder tag: keep the whole tag for the last hydration
+	if s, ok := value.(string); ok && s == "<["+expr.path+"]>" {
+		if len(expr.filters) == 0 {
+			return s, nil
+		}
+
+		return "<[" + expr.path + " " + expr.pipeline + "]>", nil
+	}
+
+	if found {
+		if value, err = x.resolveValue(expr.path, value, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	return expr.apply(value, found)
+}
+
+// resolveValue expands the tags found in the value of the variable path,
+// lists and dicts are walked through and copied.
+func (x *expansion) resolveValue(path string, value interface{}, chain []string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "<[") || v == "<["+path+"]>" {
+			return v, nil
+		}
+
+		return x.expandValue(path, v, chain)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+
+		for key, item := range v {
+			resolved, err := x.resolveValue(path+"."+key, item, chain)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = resolved
+		}
+
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(v))
+
+		for key, item := range v {
+			resolved, err := x.resolveValue(fmt.Sprintf("%s.%v", path, key), item, chain)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = resolved
+		}
+
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+
+		for i, item := range v {
+			resolved, err := x.resolveValue(path+"."+strconv.Itoa(i), item, chain)
+			if err != nil {
+				return nil, err
+			}
+
+			result[i] = resolved
+		}
+
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// expandValue expands the tags found in the value of the variable path.
+func (x *expansion) expandValue(path, value string, chain []string) (interface{}, error) {
+	for i, p := range chain {
+		if p == path {
+			cycle := append(chain[i:len(chain):len(chain)], path)
+
+			return nil, fmt.Errorf("recursive variable reference: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	chain = append(chain[:len(chain):len(chain)], path)
+
+	if len(chain) > x.maxDepth {
+		return nil, fmt.Errorf(
+			"maximum variable expansion depth (%d) exceeded: %s", x.maxDepth, strings.Join(chain, " -> "),
+		)
+	}
+
+	// a value made of a single tag keeps the type of the referenced variable
+	if tag, ok := singleTag(value); ok {
+		return x.lookup(tag, chain)
+	}
+
+	s, err := x.expandString(value, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.ReplaceAll(s, escapedTagPlaceholder, escapedTag), nil
+}
+
+// expandString replaces the tags of a string, the escaped tags of the result
+// are replaced by escapedTagPlaceholder.
+func (x *expansion) expandString(input string, chain []string) (string, error) {
+	input = strings.ReplaceAll(input, escapedTag, escapedTagPlaceholder)
+
+	var output strings.Builder
+
+	for {
+		start := strings.Index(input, "<[")
+		if start < 0 {
+			output.WriteString(input)
+
+			return output.String(), nil
+		}
+
+		end := tagEnd(input[start+2:])
+		if end < 0 {
+			return "", fmt.Errorf("cannot find the end of the tag: %s", input[start:])
+		}
+
+		output.WriteString(input[:start])
+
+		val, err := x.lookup(input[start+2:start+2+end], chain)
+		if err != nil {
+			return "", err
+		}
+
+		switch v := val.(type) {
+		case string:
+			output.WriteString(strings.ReplaceAll(strings.TrimSuffix(v, "\n"), escapedTag, escapedTagPlaceholder))
+		case int:
+			output.WriteString(strconv.Itoa(v))
+		default:
+			if err := yaml.NewEncoder(&output).Encode(val); err != nil {
+				return "", err
+			}
+		}
+
+		input = input[start+2+end+2:]
+	}
+}
+
+// singleTag returns the content of the tag when s is made of a single tag.
+func singleTag(s string) (string, bool) {
+	if !strings.HasPrefix(s, "<[") {
+		return "", false
+	}
+
+	end := tagEnd(s[2:])
+	if end < 0 || end+4 != len(s) {
+		return "", false
+	}
+
+	return s[2 : 2+end], true
+}
+
+// tagEnd returns the index of the `]>` closing a tag whose content starts s,
+// or -1. The `]>` found in the quoted filter arguments do not close the tag.
+func tagEnd(s string) int {
+	var (
+		quote   rune
+		escaped bool
+	)
+
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case strings.HasPrefix(s[i:], "]>"):
+			return i
+		}
+	}
+
+	return -1
+}
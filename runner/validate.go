@@ -0,0 +1,351 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	hv "github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// yaml.v3 reports errors as "line N: message".
+	yamlErrorLineRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// yaml.v3 reports unknown fields as "field x not found in type runner.Config".
+	yamlUnknownFieldRe = regexp.MustCompile(`^field (\S+) not found in type (?:\S+\.)?(\S+)$`)
+	// the names of the environment variables the env section can declare.
+	envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ConfigError is an error found in a beaver config file.
+type ConfigError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	case e.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	}
+}
+
+// decodeError turns a yaml.v3 decoding error into ConfigErrors.
+func decodeError(file string, err error) error {
+	var messages []string
+
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		messages = typeError.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	errs := make([]error, 0, len(messages))
+
+	for _, msg := range messages {
+		configErr := ConfigError{File: file, Msg: msg}
+
+		if m := yamlErrorLineRe.FindStringSubmatch(msg); m != nil {
+			configErr.Line, _ = strconv.Atoi(m[1])
+			configErr.Msg = m[2]
+		}
+
+		if m := yamlUnknownFieldRe.FindStringSubmatch(configErr.Msg); m != nil {
+			configErr.Msg = fmt.Sprintf("unknown field %q in %s", m[1], strings.ToLower(m[2]))
+		}
+
+		errs = append(errs, &configErr)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate runs semantic checks on a config, it reports every error found
+// along with its position in the config file.
+func (c *Config) Validate() error {
+	var errs []error
+
+	fail := func(node *yaml.Node, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{
+			File:   c.File,
+			Line:   node.Line,
+			Column: node.Column,
+			Msg:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	if c.BeaverVersion != "" {
+		if _, err := hv.NewConstraint(c.BeaverVersion); err != nil {
+			fail(c.nodeAt("beaverversion"), "invalid beaverversion %q: %s", c.BeaverVersion, err)
+		}
+	}
+
+	names := make([]string, 0, len(c.Charts))
+	for name := range c.Charts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		chart := c.Charts[name]
+
+		engine, ok := LookupEngine(chart.Type)
+
+		switch {
+		case chart.Type == "" && chart.Disabled == "":
+			fail(c.nodeAt("charts", name), "chart %q: missing type", name)
+		case chart.Type != "" && !ok:
+			fail(
+				c.nodeAt("charts", name, "type"),
+				"chart %q: unknown type %q, must be one of: %s",
+				name, chart.Type, strings.Join(ChartTypes(), ", "),
+			)
+		}
+
+		if !ok {
+			continue
+		}
+
+		for _, chartErr := range engine.Validate(chart) {
+			node := c.nodeAt("charts", name)
+			if chartErr.Field != "" {
+				node = c.nodeAt("charts", name, chartErr.Field)
+			}
+
+			fail(node, "chart %q: %s", name, chartErr.Msg)
+		}
+	}
+
+	for i, sha := range c.Sha {
+		index := strconv.Itoa(i)
+
+		if sha.Key == "" {
+			fail(c.nodeAt("sha", index), "sha #%d: missing key", i)
+		}
+
+		if sha.Resource == "" {
+			fail(c.nodeAt("sha", index), "sha #%d: missing resource", i)
+		}
+	}
+
+	for i, create := range c.Creates {
+		index := strconv.Itoa(i)
+
+		if create.Type == "" || create.Name == "" {
+			fail(c.nodeAt("create", index), "create #%d: type and name are required", i)
+		}
+
+		for j, arg := range create.Args {
+			if arg.Flag == "" {
+				fail(
+					c.nodeAt("create", index, "args", strconv.Itoa(j)),
+					"create %s %s: arg #%d has no flag", create.Type, create.Name, j,
+				)
+			}
+		}
+	}
+
+	for _, block := range c.variableBlocks() {
+		for i, variable := range block.variables {
+			node := c.variableNode(block.key, i, variable.Name)
+
+			if block.merge != "" {
+				if variable.Merge != "" {
+					fail(node, "variable %s: merge cannot be set in a %s block", variable.Name, block.key)
+
+					continue
+				}
+
+				variable.Merge = block.merge
+			}
+
+			if _, err := variable.mergeDirective(); err != nil {
+				fail(node, "%s", err)
+			}
+		}
+	}
+
+	envNames := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		envNames = append(envNames, name)
+	}
+
+	sort.Strings(envNames)
+
+	for _, name := range envNames {
+		if !envNameRe.MatchString(name) {
+			fail(c.nodeAt("env", name), "env %s: invalid environment variable name", name)
+		}
+
+		if c.Env[name].Required && c.Env[name].Default != nil {
+			fail(c.nodeAt("env", name), "env %s: a required variable cannot have a default", name)
+		}
+	}
+
+	for i, name := range c.Remove.Variables {
+		if contains(strings.Split(name, "."), "") {
+			fail(c.nodeAt("remove", "variables", strconv.Itoa(i)), "remove: invalid variable name %q", name)
+		}
+	}
+
+	for i, create := range c.Remove.Creates {
+		if create.Type == "" || create.Name == "" {
+			fail(c.nodeAt("remove", "create", strconv.Itoa(i)), "remove: create #%d: type and name are required", i)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// variableNode returns the node of the variable found at index i, named
+// name, in the given variables section, for both syntaxes of the variables.
+func (c *Config) variableNode(key string, i int, name string) *yaml.Node {
+	node := c.nodeAt(key)
+
+	if node.Kind == yaml.MappingNode {
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == name {
+				return node.Content[j]
+			}
+		}
+	}
+
+	return c.nodeAt(key, strconv.Itoa(i))
+}
+
+// nodeAt returns the node found by following the given mapping keys and
+// sequence indexes in the config document, or the closest existing parent.
+func (c *Config) nodeAt(path ...string) *yaml.Node {
+	node := &c.node
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, key := range path {
+		var next *yaml.Node
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+			}
+		case yaml.DocumentNode, yaml.ScalarNode, yaml.AliasNode:
+		}
+
+		if next == nil {
+			break
+		}
+
+		node = next
+	}
+
+	return node
+}
+
+// Validate checks the config of every layer of the project, it keeps going
+// after an invalid layer so that all the errors are reported at once.
+func (c *CmdConfig) Validate() error {
+	if len(c.Layers) != 1 {
+		return fmt.Errorf("you must only have one layer when calling Validate, found: %d", len(c.Layers))
+	}
+
+	resolvedConfigDir := filepath.Join(c.RootDir, c.Layers[0])
+
+	absConfigDir, err := filepath.Abs(resolvedConfigDir)
+	if err != nil {
+		return fmt.Errorf("failed to find abs() for %s: %w", resolvedConfigDir, err)
+	}
+
+	var errs []error
+
+	dirs := []string{absConfigDir}
+	seen := map[string]bool{absConfigDir: true}
+
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+
+		config, err := readConfig(dir)
+		if err != nil {
+			errs = append(errs, err)
+
+			// keep walking the tree with whatever could be decoded
+			if config, err = readLaxConfig(dir); err != nil {
+				continue
+			}
+		} else if err := config.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		parents, err := config.parentDirs(dir, c.Overrides)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, parent := range parents {
+			if !seen[parent] {
+				seen[parent] = true
+				dirs = append(dirs, parent)
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	// all the layers are valid, check they can be linearized
+	if _, err := newLayerGraph(c.newConfigFromDir, nil).linearize(absConfigDir); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readLaxConfig decodes the inherit settings of a config file, ignoring any
+// other error.
+func readLaxConfig(configDir string) (*Config, error) {
+	for _, ext := range []string{"yaml", "yml"} {
+		configFile, err := os.ReadFile(filepath.Join(configDir, "beaver."+ext))
+		if err != nil {
+			continue
+		}
+
+		var config struct {
+			Inherit  string   `yaml:"inherit"`
+			Inherits []string `yaml:"inherits"`
+		}
+
+		if err := yaml.Unmarshal(configFile, &config); err != nil {
+			return nil, err
+		}
+
+		return &Config{Inherit: config.Inherit, Inherits: config.Inherits}, nil
+	}
+
+	return nil, fmt.Errorf("no beaver file found in %s", configDir)
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
@@ -12,6 +13,12 @@ import (
 type Variable struct {
 	Name  string      `yaml:"name"`
 	Value interface{} `yaml:"value"`
+	// Merge: how the value is merged with the inherited one, `replace` (the
+	// default), `deep`, `append` or `prepend`
+	Merge string `yaml:"merge,omitempty"`
+	// MergeKey: the field identifying the items of the lists merged with
+	// `deep`
+	MergeKey string `yaml:"mergeKey,omitempty"`
 }
 
 type Variables []Variable
@@ -73,79 +80,255 @@ func (v *Variables) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
-func (v *Variables) Overlay(variables ...Variable) {
-	newVariables := Variables{}
+// ReadVariablesFile reads a yaml or json file of variables, written with
+// either syntax of the variables of a config file.
+func ReadVariablesFile(path string) (Variables, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read variables file: %w", err)
+	}
+
+	var variables Variables
+	if err := yaml.Unmarshal(content, &variables); err != nil {
+		return nil, fmt.Errorf("invalid variables file %s: %w", path, err)
+	}
+
+	return variables, nil
+}
 
+// Overlay sets the given variables in order. A variable name can be a dotted
+// path to set a part of an existing variable, the missing dicts of the path
+// are created. The value is merged with the existing one according to the
+// merge setting of the variable.
+func (v *Variables) Overlay(variables ...Variable) error {
 	for _, inputVar := range variables {
-		path := strings.Split(inputVar.Name, ".")
+		directive, err := inputVar.mergeDirective()
+		if err != nil {
+			return err
+		}
+
+		name := inputVar.Name
+
+		path := strings.Split(name, ".")
 		head := path[0]
 		tail := path[1:]
 
+		index := -1
+
 		for i := range *v {
 			if (*v)[i].Name == head {
-				if len(tail) == 0 {
-					(*v)[i].Value = inputVar.Value
-				} else {
-					SetVariable((*v)[i].Value, tail, inputVar.Value)
+				index = i
+
+				break
+			}
+		}
+
+		if index == -1 {
+			value := inputVar.Value
+			if len(tail) != 0 {
+				value = map[string]interface{}{}
+				if err := setVariable(value, tail, []string{head}, inputVar.Value); err != nil {
+					return fmt.Errorf("cannot set variable %s: %w", name, err)
 				}
+			}
 
-				continue
+			*v = append(*v, Variable{Name: head, Value: value})
+
+			continue
+		}
+
+		if len(tail) == 0 {
+			merged, err := directive.merge((*v)[index].Value, inputVar.Value)
+			if err != nil {
+				return fmt.Errorf("cannot merge variable %s: %w", name, err)
+			}
+
+			(*v)[index].Value = merged
+
+			continue
+		}
+
+		value := inputVar.Value
+
+		if existing, ok := LookupVariable((*v)[index].Value, strings.Join(tail, ".")); ok {
+			if value, err = directive.merge(existing, value); err != nil {
+				return fmt.Errorf("cannot merge variable %s: %w", name, err)
 			}
 		}
 
-		newVariables = append(newVariables, inputVar)
+		if (*v)[index].Value == nil {
+			(*v)[index].Value = map[string]interface{}{}
+		}
+
+		if err := setVariable((*v)[index].Value, tail, []string{head}, value); err != nil {
+			return fmt.Errorf("cannot set variable %s: %w", name, err)
+		}
 	}
 
-	*v = append(*v, newVariables...)
+	return nil
 }
 
+// SetVariable sets the value found at path in v, the missing dicts of the
+// path are created. A path which cannot be set is ignored.
 func SetVariable(v interface{}, path []string, value interface{}) {
+	_ = setVariable(v, path, nil, value)
+}
+
+// setVariable sets the value found at path in v, parent is the path of v
+// used in the errors.
+func setVariable(v interface{}, path, parent []string, value interface{}) error {
 	head := path[0]
 	tail := path[1:]
-	hasTail := len(tail) != 0
+	current := append(parent[:len(parent):len(parent)], head)
 
 	switch t := v.(type) {
 	case map[string]interface{}:
-		if hasTail {
-			nextValue, ok := t[head]
-			if !ok {
-				return
-			}
-
-			SetVariable(nextValue, tail, value)
-		} else {
+		if len(tail) == 0 {
 			t[head] = value
+
+			return nil
 		}
 
-	case map[interface{}]interface{}:
-		if hasTail {
-			nextValue, ok := t[head]
-			if !ok {
-				return
-			}
+		next, ok := t[head]
+		if !ok || next == nil {
+			next = map[string]interface{}{}
+			t[head] = next
+		}
 
-			SetVariable(nextValue, tail, value)
-		} else {
+		return setVariable(next, tail, current, value)
+	case map[interface{}]interface{}:
+		if len(tail) == 0 {
 			t[head] = value
+
+			return nil
 		}
 
+		next, ok := t[head]
+		if !ok || next == nil {
+			next = map[string]interface{}{}
+			t[head] = next
+		}
+
+		return setVariable(next, tail, current, value)
 	case []interface{}:
 		index, err := strconv.Atoi(head)
+		if err != nil || index < 0 || index >= len(t) {
+			return fmt.Errorf("%s: no such index in a list of %d items", strings.Join(current, "."), len(t))
+		}
+
+		if len(tail) == 0 {
+			t[index] = value
+
+			return nil
+		}
+
+		return setVariable(t[index], tail, current, value)
+	default:
+		if len(parent) == 0 {
+			return fmt.Errorf("cannot set %s in a %T", strings.Join(path, "."), v)
+		}
+
+		return fmt.Errorf("%s is a %T, not a dict nor a list", strings.Join(parent, "."), v)
+	}
+}
+
+// Remove deletes the variable name, which can be a dotted path to delete a
+// part of a variable.
+func (v *Variables) Remove(name string) error {
+	path := strings.Split(name, ".")
+
+	for i := range *v {
+		if (*v)[i].Name != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			*v = append((*v)[:i], (*v)[i+1:]...)
+
+			return nil
+		}
+
+		value, err := removeVariable((*v)[i].Value, path[1:], path[:1])
 		if err != nil {
-			return
+			return fmt.Errorf("cannot remove variable %s: %w", name, err)
 		}
 
-		if index >= len(t) || index < 0 {
-			return
+		(*v)[i].Value = value
+
+		return nil
+	}
+
+	return fmt.Errorf("cannot remove variable %s: %s does not exist", name, path[0])
+}
+
+// removeVariable deletes the value found at path in v and returns the
+// updated v, parent is the path of v used in the errors.
+func removeVariable(v interface{}, path, parent []string) (interface{}, error) {
+	head := path[0]
+	tail := path[1:]
+	current := append(parent[:len(parent):len(parent)], head)
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		next, ok := t[head]
+		if !ok {
+			return nil, fmt.Errorf("%s does not exist", strings.Join(current, "."))
 		}
 
-		if hasTail {
-			SetVariable(t[index], tail, value)
-		} else {
-			t[index] = value
+		if len(tail) == 0 {
+			delete(t, head)
+
+			return t, nil
+		}
+
+		value, err := removeVariable(next, tail, current)
+		if err != nil {
+			return nil, err
+		}
+
+		t[head] = value
+
+		return t, nil
+	case map[interface{}]interface{}:
+		next, ok := t[head]
+		if !ok {
+			return nil, fmt.Errorf("%s does not exist", strings.Join(current, "."))
+		}
+
+		if len(tail) == 0 {
+			delete(t, head)
+
+			return t, nil
+		}
+
+		value, err := removeVariable(next, tail, current)
+		if err != nil {
+			return nil, err
 		}
 
+		t[head] = value
+
+		return t, nil
+	case []interface{}:
+		index, err := strconv.Atoi(head)
+		if err != nil || index < 0 || index >= len(t) {
+			return nil, fmt.Errorf("%s: no such index in a list of %d items", strings.Join(current, "."), len(t))
+		}
+
+		if len(tail) == 0 {
+			return append(t[:index:index], t[index+1:]...), nil
+		}
+
+		value, err := removeVariable(t[index], tail, current)
+		if err != nil {
+			return nil, err
+		}
+
+		t[index] = value
+
+		return t, nil
 	default:
+		return nil, fmt.Errorf("%s is a %T, not a dict nor a list", strings.Join(parent, "."), v)
 	}
 }
 
@@ -194,3 +377,33 @@ func lookupVariableHelper(v interface{}, key string) (interface{}, bool) {
 		return nil, false
 	}
 }
+
+// CopyValue returns a deep copy of a variable value: maps and slices are
+// copied, other values are returned as is.
+func CopyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			result[key] = CopyValue(value)
+		}
+
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(t))
+		for key, value := range t {
+			result[key] = CopyValue(value)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, value := range t {
+			result[i] = CopyValue(value)
+		}
+
+		return result
+	default:
+		return v
+	}
+}
@@ -88,6 +88,26 @@ nested:
 	}
 }
 
+func TestOverlayExisting(t *testing.T) {
+	v := runner.Variables{
+		{Name: "image", Value: "nginx"},
+		{Name: "labels", Value: map[string]interface{}{"team": "beaver"}},
+	}
+
+	require.NoError(t, v.Overlay(
+		runner.Variable{Name: "image", Value: "httpd"},
+		runner.Variable{Name: "labels.team", Value: "otter"},
+		runner.Variable{Name: "replicas", Value: 2},
+	))
+
+	// the existing variables are updated in place, not appended again
+	assert.Equal(t, runner.Variables{
+		{Name: "image", Value: "httpd"},
+		{Name: "labels", Value: map[string]interface{}{"team": "otter"}},
+		{Name: "replicas", Value: 2},
+	}, v)
+}
+
 func TestLookupVariable(t *testing.T) {
 	variables := map[string]interface{}{
 		"string": "a string",
@@ -172,8 +192,18 @@ func TestSetVariable(t *testing.T) {
 				},
 			),
 		},
+		{
+			"map.new.key",
+			"created",
+			variables(
+				func(v V) {
+					v["map"].(map[interface{}]interface{})["new"] = map[string]interface{}{"key": "created"} //nolint:forcetypeassert
+				},
+			),
+		},
 		{"list.2.float", nil, variables()},
 		{"list.-2.float", nil, variables()},
+		{"int.float", nil, variables()},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			v := variables()
@@ -182,3 +212,260 @@ func TestSetVariable(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeValidate(t *testing.T) {
+	requireInvalid(t, "merge",
+		`2:3: variable labels: unknown merge "deeep", must be one of: replace, deep, append, prepend`,
+		"4:3: variable env: mergeKey can only be used with merge: deep",
+		"8:3: variable hosts: merge cannot be set in a variables!merge block",
+	)
+}
+
+func TestOverlay(t *testing.T) {
+	base := func() runner.Variables {
+		return runner.Variables{
+			{Name: "labels", Value: map[string]interface{}{
+				"team": "beaver",
+				"tier": map[string]interface{}{"name": "back", "level": 1},
+			}},
+			{Name: "image", Value: "nginx"},
+			{Name: "hosts", Value: []interface{}{"a.example.com"}},
+			{Name: "env", Value: []interface{}{
+				map[string]interface{}{"name": "LOG_LEVEL", "value": "info"},
+				map[string]interface{}{"name": "PORT", "value": 8080},
+			}},
+		}
+	}
+
+	hosts, env := base()[2], base()[3]
+
+	for _, tt := range []struct {
+		name     string
+		overlay  runner.Variables
+		expected runner.Variables
+		err      string
+	}{
+		{
+			"replace",
+			runner.Variables{{Name: "labels", Value: map[string]interface{}{"env": "prod"}}},
+			runner.Variables{
+				{Name: "labels", Value: map[string]interface{}{"env": "prod"}},
+				{Name: "image", Value: "nginx"},
+				hosts, env,
+			},
+			"",
+		},
+		{
+			"deep-merge",
+			runner.Variables{{Name: "labels", Merge: "deep", Value: map[string]interface{}{
+				"env":  "prod",
+				"tier": map[string]interface{}{"level": 2},
+			}}},
+			runner.Variables{
+				{Name: "labels", Value: map[string]interface{}{
+					"team": "beaver",
+					"env":  "prod",
+					"tier": map[string]interface{}{"name": "back", "level": 2},
+				}},
+				{Name: "image", Value: "nginx"},
+				hosts, env,
+			},
+			"",
+		},
+		{
+			"dotted-deep-merge",
+			runner.Variables{{Name: "labels.tier", Merge: "deep", Value: map[string]interface{}{"zone": "a"}}},
+			runner.Variables{
+				{Name: "labels", Value: map[string]interface{}{
+					"team": "beaver",
+					"tier": map[string]interface{}{"name": "back", "level": 1, "zone": "a"},
+				}},
+				{Name: "image", Value: "nginx"},
+				hosts, env,
+			},
+			"",
+		},
+		{
+			"missing-intermediate",
+			runner.Variables{{Name: "labels.owner.name", Value: "me"}, {Name: "db.host", Value: "pg"}},
+			runner.Variables{
+				{Name: "labels", Value: map[string]interface{}{
+					"team":  "beaver",
+					"tier":  map[string]interface{}{"name": "back", "level": 1},
+					"owner": map[string]interface{}{"name": "me"},
+				}},
+				{Name: "image", Value: "nginx"},
+				hosts, env,
+				{Name: "db", Value: map[string]interface{}{"host": "pg"}},
+			},
+			"",
+		},
+		{
+			"append",
+			runner.Variables{{Name: "hosts", Merge: "append", Value: []interface{}{"b.example.com"}}},
+			runner.Variables{
+				base()[0], base()[1],
+				{Name: "hosts", Value: []interface{}{"a.example.com", "b.example.com"}},
+				env,
+			},
+			"",
+		},
+		{
+			"prepend",
+			runner.Variables{{Name: "hosts", Merge: "prepend", Value: []interface{}{"b.example.com"}}},
+			runner.Variables{
+				base()[0], base()[1],
+				{Name: "hosts", Value: []interface{}{"b.example.com", "a.example.com"}},
+				env,
+			},
+			"",
+		},
+		{
+			"append-new",
+			runner.Variables{{Name: "cidrs", Merge: "append", Value: []interface{}{"10.0.0.0/8"}}},
+			append(base(), runner.Variable{Name: "cidrs", Value: []interface{}{"10.0.0.0/8"}}),
+			"",
+		},
+		{
+			"merge-by-key",
+			runner.Variables{{Name: "env", Merge: "deep", MergeKey: "name", Value: []interface{}{
+				map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+				map[string]interface{}{"name": "DEBUG", "value": true},
+			}}},
+			runner.Variables{
+				base()[0], base()[1], hosts,
+				{Name: "env", Value: []interface{}{
+					map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+					map[string]interface{}{"name": "PORT", "value": 8080},
+					map[string]interface{}{"name": "DEBUG", "value": true},
+				}},
+			},
+			"",
+		},
+		{
+			"append-to-a-dict",
+			runner.Variables{{Name: "labels", Merge: "append", Value: []interface{}{"x"}}},
+			nil,
+			"cannot merge variable labels: cannot append to a map[string]interface {}, not a list",
+		},
+		{
+			"merge-list-without-key",
+			runner.Variables{{Name: "env", Merge: "deep", Value: []interface{}{}}},
+			nil,
+			"cannot merge variable env: merging lists needs the key identifying their items, eg. mergeKey: name",
+		},
+		{
+			"merge-item-without-key",
+			runner.Variables{{Name: "env", Merge: "deep", MergeKey: "name", Value: []interface{}{
+				map[string]interface{}{"value": 1},
+			}}},
+			nil,
+			`cannot merge variable env: item 0 has no "name" key`,
+		},
+		{
+			"crossing-a-scalar",
+			runner.Variables{{Name: "labels.team.name", Value: "beaver"}},
+			nil,
+			"cannot set variable labels.team.name: labels.team is a string, not a dict nor a list",
+		},
+		{
+			"missing-index",
+			runner.Variables{{Name: "hosts.2", Value: "c.example.com"}},
+			nil,
+			"cannot set variable hosts.2: hosts.2: no such index in a list of 1 items",
+		},
+		{
+			"unknown-merge",
+			runner.Variables{{Name: "labels", Merge: "deeep", Value: map[string]interface{}{}}},
+			nil,
+			`variable labels: unknown merge "deeep", must be one of: replace, deep, append, prepend`,
+		},
+		{
+			"key-without-deep-merge",
+			runner.Variables{{Name: "env", Merge: "append", MergeKey: "name", Value: []interface{}{}}},
+			nil,
+			`variable env: mergeKey can only be used with merge: deep`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v := base()
+
+			err := v.Overlay(tt.overlay...)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestVariablesRemove(t *testing.T) {
+	type V = map[string]interface{}
+
+	variables := func(setters ...func(V)) V {
+		ret := V{
+			"string": "a string",
+			"int":    3,
+			"map": map[interface{}]interface{}{
+				"float": 12.3,
+			},
+			"list": []interface{}{
+				map[interface{}]interface{}{
+					"float": 12.3,
+				},
+			},
+		}
+		for _, s := range setters {
+			s(ret)
+		}
+
+		return ret
+	}
+
+	for _, tt := range []struct {
+		name     string
+		expected interface{}
+		err      string
+	}{
+		{"string", variables(func(v V) { delete(v, "string") }), ""},
+		{
+			"map.float",
+			variables(func(v V) {
+				delete(v["map"].(map[interface{}]interface{}), "float") //nolint:forcetypeassert
+			}),
+			"",
+		},
+		{"list.0", variables(func(v V) { v["list"] = []interface{}{} }), ""},
+		{"missing", nil, "cannot remove variable missing: missing does not exist"},
+		{"map.missing", nil, "cannot remove variable map.missing: map.missing does not exist"},
+		{"list.1", nil, "cannot remove variable list.1: list.1: no such index in a list of 1 items"},
+		{"int.float", nil, "cannot remove variable int.float: int is a int, not a dict nor a list"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v := runner.Variables{}
+			for name, value := range variables() {
+				v = append(v, runner.Variable{Name: name, Value: value})
+			}
+
+			err := v.Remove(tt.name)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			result := V{}
+			for _, variable := range v {
+				result[variable.Name] = variable.Value
+			}
+
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// WatchedPaths returns the files and directories a build depends on: the
+// layer directories (config, value and ytt files), their `ytt` and
+// `kustomize` directories, the paths of the charts given by their engine and
+// the `create` sources. It must be called after Load, before the value files
+// are hydrated.
+func (c *CmdConfig) WatchedPaths() []string {
+	var paths []string
+
+	add := func(path string) {
+		if _, err := os.Stat(path); err == nil && !contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+
+	for _, layer := range c.Layers {
+		add(layer)
+		add(filepath.Join(layer, "ytt"))
+		add(filepath.Join(layer, "kustomize"))
+	}
+
+	for _, file := range c.Spec.VariablesFiles {
+		add(file)
+	}
+
+	for _, chart := range c.Spec.Charts {
+		if engine, ok := LookupEngine(chart.Type); ok {
+			for _, path := range engine.WatchedPaths(chart) {
+				add(path)
+			}
+		}
+
+		for _, file := range chart.ValuesFileNames {
+			add(file)
+		}
+	}
+
+	for _, create := range c.Spec.Creates {
+		add(create.Dir)
+
+		for _, arg := range create.Args {
+			if arg.Value == "" {
+				continue
+			}
+
+			// only values which are actual files, eg. --from-file
+			path := arg.Value
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(create.Dir, path)
+			}
+
+			add(path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// IgnoredPaths returns the files and directories a build writes itself, which
+// may be found in the watched paths: the output directory, and the `charts`
+// directory and `Chart.lock` file of the helm charts whose dependencies are
+// built. It must be called after Load.
+func (r *Runner) IgnoredPaths() ([]string, error) {
+	var paths []string
+
+	outputDir, err := r.OutputDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if outputDir != stdOut {
+		outputDir, err = filepath.Abs(outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find abs() for %s: %w", outputDir, err)
+		}
+
+		paths = append(paths, outputDir)
+	}
+
+	charts, err := r.config.HelmChartsPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chart := range charts {
+		helmChart, err := getHelmChart(chart)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(helmChart.Dependencies) != 0 {
+			paths = append(paths, filepath.Join(chart, "charts"), filepath.Join(chart, "Chart.lock"))
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Watch calls build each time a file found in the watched paths changes,
+// except for the files found in the ignored paths, that a build writes itself.
+// Events are debounced, a change made while building triggers another build.
+// The paths are refreshed after each build, directories are watched
+// recursively. Watch returns when ctx is done.
+func Watch(
+	ctx context.Context,
+	logger zerolog.Logger,
+	debounce time.Duration,
+	paths func() (watchedPaths, ignoredPaths []string, err error),
+	build func(),
+) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot create file watcher: %w", err)
+	}
+
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+
+	var ignored []string
+
+	refresh := func() {
+		roots, ignoredPaths, err := paths()
+		if err != nil {
+			logger.Err(err).Msg("cannot list watched paths, keeping the previous ones")
+
+			return
+		}
+
+		ignored = ignoredPaths
+		wanted := make(map[string]bool)
+
+		for _, root := range roots {
+			for _, path := range watchedDirs(root, ignored) {
+				wanted[path] = true
+			}
+		}
+
+		for path := range watched {
+			if !wanted[path] {
+				_ = watcher.Remove(path)
+
+				delete(watched, path)
+			}
+		}
+
+		for path := range wanted {
+			if watched[path] {
+				continue
+			}
+
+			if err := watcher.Add(path); err != nil {
+				logger.Err(err).Str("path", path).Msg("cannot watch path")
+
+				continue
+			}
+
+			watched[path] = true
+		}
+
+		logger.Debug().Int("paths", len(watched)).Msg("watching for changes")
+	}
+
+	refresh()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			logger.Err(err).Msg("file watcher error")
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && watched[event.Name] {
+				// the watch is gone with the file, it will be added back
+				// by the next refresh if the file is recreated
+				delete(watched, event.Name)
+			}
+
+			if ignoredEvent(event, ignored) {
+				continue
+			}
+
+			logger.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("change detected")
+			timer.Reset(debounce)
+
+		case <-timer.C:
+			build()
+			refresh()
+		}
+	}
+}
+
+// watchedDirs returns the paths to give to fsnotify for a watched path:
+// a file is watched as is, a directory is watched with its subdirectories
+// which are not ignored.
+func watchedDirs(root string, ignored []string) []string {
+	info, err := os.Stat(root)
+	if err != nil || inPaths(root, ignored) {
+		return nil
+	}
+
+	if !info.IsDir() {
+		return []string{root}
+	}
+
+	var dirs []string
+
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil //nolint:nilerr
+		}
+
+		if path != root && (strings.HasPrefix(d.Name(), ".") || inPaths(path, ignored)) {
+			return filepath.SkipDir
+		}
+
+		dirs = append(dirs, path)
+
+		return nil
+	})
+
+	return dirs
+}
+
+// ignoredEvent filters out the files beaver writes itself during a build: the
+// ignored paths and the `.beaver-` build temp directories.
+func ignoredEvent(event fsnotify.Event, ignored []string) bool {
+	if event.Op == fsnotify.Chmod {
+		return true
+	}
+
+	return strings.HasPrefix(filepath.Base(event.Name), ".beaver-") || inPaths(event.Name, ignored)
+}
+
+// inPaths tells whether path is one of the given paths or is found in one of
+// them.
+func inPaths(path string, paths []string) bool {
+	for _, p := range paths {
+		if rel, err := filepath.Rel(p, path); err == nil && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
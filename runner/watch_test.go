@@ -0,0 +1,124 @@
+package runner_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"orus.io/orus-io/beaver/runner"
+	"orus.io/orus-io/beaver/testutils"
+)
+
+func TestWatchedPaths(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs(fixtures)
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, envNS1, false, false, "", "")
+	require.NoError(t, c.Load())
+
+	paths := c.WatchedPaths()
+
+	for _, expected := range []string{
+		filepath.Join(absConfigDir, "base"),
+		filepath.Join(absConfigDir, "base", "ytt"),
+		filepath.Join(absConfigDir, envNS1),
+		filepath.Join(absConfigDir, envNS1, "kustomize"),
+		filepath.Join(absConfigDir, envNS1, "odoo.yml"),
+		filepath.Join(absConfigDir, envNS1, "pipelines"),
+		filepath.Join(absConfigDir, "vendor", "helm", "postgresql"),
+		filepath.Join(absConfigDir, "vendor", "ytt", "odoo"),
+	} {
+		assert.Contains(t, paths, expected)
+	}
+}
+
+func TestIgnoredPaths(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	absConfigDir, err := filepath.Abs("fixtures/f4")
+	require.NoError(t, err)
+
+	c := runner.NewCmdConfig(tl.Logger(), absConfigDir, "base", true, false, "", "")
+	require.NoError(t, c.Load())
+
+	paths, err := runner.NewRunner(c).IgnoredPaths()
+	require.NoError(t, err)
+
+	// hcl3 has no dependency, helm writes nothing in it
+	assert.Equal(t, []string{
+		filepath.Join(absConfigDir, "base", "hcl1", "Chart.lock"),
+		filepath.Join(absConfigDir, "base", "hcl1", "charts"),
+		filepath.Join(absConfigDir, "base", "hcl2", "Chart.lock"),
+		filepath.Join(absConfigDir, "base", "hcl2", "charts"),
+		filepath.Join(absConfigDir, "build"),
+	}, paths)
+}
+
+func TestWatch(t *testing.T) {
+	tl := testutils.NewTestLogger(t)
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "sub")
+	outputDir := filepath.Join(dir, "build")
+	require.NoError(t, os.Mkdir(subDir, 0o700))
+	require.NoError(t, os.Mkdir(outputDir, 0o700))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	builds := make(chan struct{}, 10)
+	count := 0
+	done := make(chan error)
+
+	go func() {
+		done <- runner.Watch(
+			ctx,
+			tl.Logger(),
+			50*time.Millisecond,
+			func() ([]string, []string, error) { return []string{dir}, []string{outputDir}, nil },
+			func() {
+				count++
+
+				// a change made while building triggers another build
+				if count == 1 {
+					assert.NoError(t, os.WriteFile(filepath.Join(subDir, "c.yaml"), []byte("c: d\n"), 0o600))
+				}
+
+				builds <- struct{}{}
+			},
+		)
+	}()
+
+	// let the watcher start
+	time.Sleep(100 * time.Millisecond)
+
+	// several changes in a row trigger a single build
+	for _, name := range []string{"a.yaml", "b.yaml", "a.yaml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(subDir, name), []byte("a: b\n"), 0o600))
+	}
+
+	for range 2 {
+		select {
+		case <-builds:
+		case <-ctx.Done():
+			t.Fatal("no build triggered")
+		}
+	}
+
+	// files written by beaver itself are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "configmap.v1.beaver.yaml"), []byte{}, 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".beaver-123"), 0o700))
+
+	select {
+	case <-builds:
+		t.Fatal("unexpected build")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}